@@ -13,6 +13,7 @@ require (
 	github.com/google/go-github/v55 v55.0.0
 	github.com/gregjones/httpcache v0.0.0-20190611155906-901d90724c79
 	github.com/jmespath/go-jmespath v0.4.0
+	github.com/klauspost/compress v1.16.7
 	github.com/magefile/mage v1.15.0
 	github.com/mattn/go-colorable v0.1.13
 	github.com/mattn/go-isatty v0.0.18
@@ -24,6 +25,8 @@ require (
 	go.k6.io/xk6 v0.9.2
 	golang.org/x/net v0.10.0
 	golang.org/x/sys v0.11.0
+	golang.org/x/time v0.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -53,8 +56,6 @@ require (
 	golang.org/x/sync v0.2.0 // indirect
 	golang.org/x/term v0.11.0 // indirect
 	golang.org/x/text v0.12.0 // indirect
-	golang.org/x/time v0.3.0 // indirect
 	golang.org/x/tools v0.6.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 	gotest.tools/v3 v3.5.1 // indirect
 )
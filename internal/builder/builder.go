@@ -16,7 +16,12 @@ import (
 )
 
 type Builder interface {
-	Build(ctx context.Context, platform *Platform, mods dependency.Modules, out io.Writer) error
+	Build(
+		ctx context.Context,
+		platform *Platform,
+		mods dependency.Modules,
+		out io.Writer,
+	) (*Manifest, error)
 	Engine() Engine
 }
 
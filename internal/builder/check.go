@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+)
+
+var errNotReady = errors.New("builder is not ready")
+
+// checker is implemented by builders able to check whether they are usable.
+type checker interface {
+	check(ctx context.Context) error
+}
+
+// Check returns an error if the builder is not usable (e.g. the Docker Engine is not available).
+func Check(ctx context.Context, builder Builder) error {
+	if c, ok := builder.(checker); ok {
+		return c.check(ctx)
+	}
+
+	return nil
+}
+
+func (b *nativeBuilder) check(_ context.Context) error {
+	if _, err := exec.LookPath("go"); err != nil {
+		return fmt.Errorf("%w: %s", errNotReady, err.Error())
+	}
+
+	return nil
+}
+
+func (b *dockerBuilder) check(ctx context.Context) error {
+	if _, err := b.cli.Ping(ctx); err != nil {
+		return fmt.Errorf("%w: %s", errNotReady, err.Error())
+	}
+
+	return nil
+}
+
+func (b *serviceBuilder) check(ctx context.Context) error {
+	err := b.failover(ctx, func(ep *serviceEndpoint) error {
+		resp, err := b.do(ctx, ep, http.MethodGet, "/healthz")
+		if err != nil {
+			return err
+		}
+
+		defer resp.Body.Close() //nolint:errcheck
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%w: %w: %s", errService, errServiceUnavailable, resp.Status)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s", errNotReady, err.Error())
+	}
+
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/szkiba/k6x/internal/dependency"
@@ -31,9 +32,29 @@ const (
 	cacheVolume  = "k6x-cache"
 	cachePath    = "/cache"
 	workdirPath  = "/home/k6x"
+
+	removeTimeout = 30 * time.Second
 )
 
-func (b *dockerBuilder) cmdline(platform *Platform, mods dependency.Modules) ([]string, []string) {
+// imageTag is the tag of the builder image released together with this k6x version (set by the release build).
+// The released images before it don't support the build option and --go-version flags.
+var imageTag = "latest" //nolint:gochecknoglobals
+
+// image returns the builder image. The default builds use the latest released image,
+// the builds with options or go version constraints need the image of the same release.
+func image(ctx context.Context) string {
+	if optionsFromContext(ctx).Default() && goVersionFromContext(ctx) == nil {
+		return builderImage
+	}
+
+	return builderImage + ":" + imageTag
+}
+
+func (b *dockerBuilder) cmdline(
+	ctx context.Context,
+	platform *Platform,
+	mods dependency.Modules,
+) ([]string, []string) {
 	args := make([]string, 0, 2*len(mods))
 	env := make([]string, 0, 1)
 
@@ -46,6 +67,12 @@ func (b *dockerBuilder) cmdline(platform *Platform, mods dependency.Modules) ([]
 		args = append(args, "--with", mod.Name+" "+mod.Tag())
 	}
 
+	args = append(args, optionsFromContext(ctx).args()...)
+
+	if constraints := goVersionFromContext(ctx); constraints != nil {
+		args = append(args, "--go-version", constraints.String())
+	}
+
 	return args, env
 }
 
@@ -100,9 +127,9 @@ func (b *dockerBuilder) close() {
 }
 
 func (b *dockerBuilder) pull(ctx context.Context) error {
-	logrus.Debugf("Pulling %s image", builderImage)
+	logrus.Debugf("Pulling %s image", image(ctx))
 
-	reader, err := b.cli.ImagePull(ctx, builderImage, types.ImagePullOptions{})
+	reader, err := b.cli.ImagePull(ctx, image(ctx), types.ImagePullOptions{})
 	if err != nil {
 		return err
 	}
@@ -146,12 +173,12 @@ func (b *dockerBuilder) start(
 	platform *Platform,
 	mods dependency.Modules,
 ) (string, error) {
-	cmd, env := b.cmdline(platform, mods)
+	cmd, env := b.cmdline(ctx, platform, mods)
 
 	logrus.Debugf("Executing %s", strings.Join(cmd, " "))
 
 	conf := &container.Config{
-		Image: builderImage,
+		Image: image(ctx),
 		Cmd:   cmd,
 		Tty:   false,
 		Env:   env,
@@ -174,12 +201,22 @@ func (b *dockerBuilder) start(
 
 	logrus.Debugf("Starting container: %s", resp.ID)
 	if err = b.cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		return "", err
+		return resp.ID, err
 	}
 
 	return resp.ID, nil
 }
 
+// remove removes the container, even if the build context has already been canceled.
+func (b *dockerBuilder) remove(id string) error {
+	logrus.Debugf("Removing container: %s", id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), removeTimeout)
+	defer cancel()
+
+	return b.cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true})
+}
+
 func (b *dockerBuilder) wait(ctx context.Context, id string) error {
 	statusCh, errCh := b.cli.ContainerWait(ctx, id, container.WaitConditionNotRunning)
 	select {
@@ -258,14 +295,18 @@ func (b *dockerBuilder) Build(
 	platform *Platform,
 	mods dependency.Modules,
 	out io.Writer,
-) error {
+) (*Manifest, error) {
 	defer b.close()
 
 	if platform == nil {
 		platform = RuntimePlatform()
 	}
 
-	return b.build(ctx, platform, mods, out)
+	return track(ctx, b.Engine(), platform, mods, out, func(man *Manifest, out io.Writer) error {
+		man.Toolchain["image"] = image(ctx)
+
+		return b.build(ctx, platform, mods, out)
+	})
 }
 
 func (b *dockerBuilder) build(
@@ -273,27 +314,26 @@ func (b *dockerBuilder) build(
 	platform *Platform,
 	mods dependency.Modules,
 	out io.Writer,
-) error {
+) (err error) {
 	logrus.Debug("Building new k6 binary (docker)")
 
-	if err := b.pull(ctx); err != nil {
+	if err = b.pull(ctx); err != nil {
 		return err
 	}
 
 	id, err := b.start(ctx, platform, mods)
+	if len(id) != 0 {
+		defer func() {
+			if rerr := b.remove(id); rerr != nil && err == nil {
+				err = rerr
+			}
+		}()
+	}
+
 	if err != nil {
 		return err
 	}
 
-	defer func() {
-		logrus.Debugf("Removing container: %s", id)
-
-		rerr := b.cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{})
-		if rerr != nil && err == nil {
-			err = rerr
-		}
-	}()
-
 	if err = b.wait(ctx, id); err != nil {
 		return err
 	}
@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package builder
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var errContentEncoding = errors.New("unsupported content encoding")
+
+// acceptEncoding lists the content encodings of the k6 binary accepted from the builder service.
+const acceptEncoding = "zstd, gzip"
+
+// decodeBody returns the decompressed body, according to the content encoding.
+func decodeBody(encoding string, body io.Reader) (io.ReadCloser, error) {
+	switch encoding = strings.ToLower(encoding); encoding {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case "gzip":
+		return gzip.NewReader(body)
+	case "zstd":
+		decoder, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", errContentEncoding, encoding)
+	}
+}
@@ -0,0 +1,290 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	serviceInfoTimeout = 2 * time.Second
+	serviceInfoPath    = "/info"
+	serviceStatusOK    = "ok"
+
+	// serviceProbeInterval is the minimum time between the probes of an unavailable endpoint.
+	serviceProbeInterval = 30 * time.Second
+)
+
+// endpoint selection strategies
+const (
+	strategyOrder   = "order"
+	strategyLatency = "latency"
+)
+
+var (
+	errServiceUnavailable = errors.New("build service unavailable")
+	errServiceStrategy    = errors.New("invalid build service strategy")
+)
+
+// serviceEndpoint is an endpoint of the build service. The unavailable endpoints are probed again on demand,
+// at most once in serviceProbeInterval.
+type serviceEndpoint struct {
+	url string
+
+	mu        sync.Mutex
+	platforms []string
+	latency   time.Duration
+	available bool
+	probed    time.Time
+}
+
+// supports reports whether the endpoint supports the platform (all platforms are supposed to be supported without info).
+func (ep *serviceEndpoint) supports(platform *Platform) bool {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	if ep.platforms == nil {
+		return true
+	}
+
+	for _, str := range ep.platforms {
+		if str == platform.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// state returns whether the endpoint is available, and whether it is due to be probed again if not.
+func (ep *serviceEndpoint) state() (bool, bool) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	return ep.available, time.Since(ep.probed) >= serviceProbeInterval
+}
+
+// update records the outcome of a probe (or a failed request) of the endpoint.
+func (ep *serviceEndpoint) update(available bool, platforms []string, latency time.Duration) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+
+	ep.available = available
+	ep.probed = time.Now()
+
+	if available {
+		ep.platforms, ep.latency = platforms, latency
+	}
+}
+
+// serviceEndpoints returns the comma or space separated build service endpoints (K6X_BUILDER_SERVICE).
+func serviceEndpoints() []string {
+	return strings.FieldsFunc(os.Getenv("K6X_BUILDER_SERVICE"), func(r rune) bool { //nolint:forbidigo
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// serviceStrategy validates the endpoint selection strategy:
+// the endpoints are used in the given order (default) or ordered by the latency of the info request.
+func serviceStrategy(strategy string) (string, error) {
+	switch strategy {
+	case "", strategyOrder:
+		return strategyOrder, nil
+	case strategyLatency:
+		return strategyLatency, nil
+	default:
+		return "", fmt.Errorf("%w: %s", errServiceStrategy, strategy)
+	}
+}
+
+// serviceInfo describes the build service.
+type serviceInfo struct {
+	Version   string   `json:"version"`
+	Status    string   `json:"status"`
+	Platforms []string `json:"platforms"`
+}
+
+// discover probes the endpoints concurrently and returns all of them, the available endpoints first,
+// ordered according to the strategy. The unavailable endpoints are kept, they are probed again on demand.
+func (b *serviceBuilder) discover(ctx context.Context, urls []string, strategy string) []*serviceEndpoint {
+	endpoints := make([]*serviceEndpoint, len(urls))
+
+	var wg sync.WaitGroup
+
+	for idx, url := range urls {
+		endpoints[idx] = &serviceEndpoint{url: strings.TrimSuffix(url, "/")}
+
+		wg.Add(1)
+
+		go func(ep *serviceEndpoint) {
+			defer wg.Done()
+
+			b.probe(ctx, ep)
+		}(endpoints[idx])
+	}
+
+	wg.Wait()
+
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		if endpoints[i].available != endpoints[j].available {
+			return endpoints[i].available
+		}
+
+		return strategy == strategyLatency && endpoints[i].latency < endpoints[j].latency
+	})
+
+	return endpoints
+}
+
+// probe queries the info of the endpoint and records whether it is available. The reason of skipping
+// an endpoint is logged.
+func (b *serviceBuilder) probe(ctx context.Context, ep *serviceEndpoint) bool {
+	started := time.Now()
+
+	info, err := b.info(ctx, ep)
+	if err != nil {
+		logrus.WithError(err).Warnf("build service %s is not available, skipped", ep.url)
+		ep.update(false, nil, 0)
+
+		return false
+	}
+
+	latency := time.Since(started)
+
+	if info == nil {
+		logrus.Debugf("Build service %s info is not available", ep.url)
+		ep.update(true, nil, latency)
+
+		return true
+	}
+
+	if info.Status != serviceStatusOK {
+		logrus.Warnf("build service %s status is %s, skipped", ep.url, info.Status)
+		ep.update(false, nil, 0)
+
+		return false
+	}
+
+	logrus.Debugf("Build service %s (version %s) responded in %s", ep.url, info.Version, latency)
+	ep.update(true, info.Platforms, latency)
+
+	return true
+}
+
+// ready reports whether the endpoint can be used, an unavailable endpoint is probed again if it is due.
+func (b *serviceBuilder) ready(ctx context.Context, ep *serviceEndpoint) bool {
+	available, due := ep.state()
+	if available {
+		return true
+	}
+
+	return due && b.probe(ctx, ep)
+}
+
+// available reports whether any of the endpoints is available.
+func (b *serviceBuilder) available() bool {
+	for _, ep := range b.endpoints {
+		if available, _ := ep.state(); available {
+			return true
+		}
+	}
+
+	return false
+}
+
+// info queries the service info with a short timeout. Returns nil if the service does not provide info.
+func (b *serviceBuilder) info(ctx context.Context, ep *serviceEndpoint) (*serviceInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, serviceInfoTimeout)
+	defer cancel()
+
+	resp, err := b.do(ctx, ep, http.MethodGet, serviceInfoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil //nolint:nilnil
+	default:
+		return nil, statusError(resp)
+	}
+
+	info := new(serviceInfo)
+
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, fmt.Errorf("%w: %s", errService, err.Error())
+	}
+
+	return info, nil
+}
+
+// failover calls fn with the endpoints, starting with the active one, until it succeeds.
+// The next endpoint is used if the endpoint is unavailable (connection error or server error)
+// or it doesn't support the platform. The endpoint which succeeded becomes the active one.
+// The unavailable endpoints are skipped until they are probed again.
+func (b *serviceBuilder) failover(ctx context.Context, fn func(ep *serviceEndpoint) error) error {
+	b.mu.Lock()
+	active := b.active
+	b.mu.Unlock()
+
+	var err error
+
+	for i := range b.endpoints {
+		idx := (active + i) % len(b.endpoints)
+		ep := b.endpoints[idx]
+
+		if !b.ready(ctx, ep) {
+			err = fmt.Errorf("%w: %s", errServiceUnavailable, ep.url)
+
+			continue
+		}
+
+		if err = fn(ep); err == nil {
+			b.activate(idx)
+
+			return nil
+		}
+
+		if ctx.Err() != nil || !(errors.Is(err, errServiceUnavailable) || errors.Is(err, errServicePlatform)) {
+			return err
+		}
+
+		if errors.Is(err, errServiceUnavailable) {
+			ep.update(false, nil, 0)
+		}
+
+		if i+1 < len(b.endpoints) {
+			logrus.WithError(err).Warnf("build service %s failed, trying next endpoint", ep.url)
+		}
+	}
+
+	return err
+}
+
+func (b *serviceBuilder) activate(idx int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.active != idx {
+		logrus.Infof("using build service %s", b.endpoints[idx].url)
+
+		b.active = idx
+	}
+}
@@ -0,0 +1,9 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package builder
+
+func BuildFlags(opts *Options) string {
+	return opts.buildFlags()
+}
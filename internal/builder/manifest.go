@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+//nolint:revive
+package builder
+
+import (
+	"context"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/szkiba/k6x/internal/dependency"
+)
+
+const ManifestSuffix = ".manifest.json"
+
+// Manifest describes how a k6 binary was built.
+type Manifest struct {
+	Engine       Engine             `json:"engine"`
+	Platform     *Platform          `json:"platform"`
+	Modules      dependency.Modules `json:"modules"`
+	Replacements Replacements       `json:"replacements,omitempty"`
+	Options      *Options           `json:"options,omitempty"`
+	Filter       string             `json:"filter,omitempty"`
+	Toolchain    map[string]string  `json:"toolchain,omitempty"`
+	Started      time.Time          `json:"started"`
+	Finished     time.Time          `json:"finished"`
+	Size         int64              `json:"size"`
+	SHA256       string             `json:"sha256"`
+	Cached       bool               `json:"cached,omitempty"`
+}
+
+// ManifestFile returns the sidecar manifest location of the given binary.
+func ManifestFile(binary string) string {
+	return binary + ManifestSuffix
+}
+
+func newManifest(ctx context.Context, engine Engine, platform *Platform, mods dependency.Modules) *Manifest {
+	man := new(Manifest)
+
+	man.Engine = engine
+	man.Platform = platform
+	man.Modules = mods
+	man.Replacements = replacementsFromContext(ctx)
+	man.Options = optionsFromContext(ctx)
+	man.Toolchain = make(map[string]string)
+	man.Started = time.Now().UTC()
+
+	return man
+}
+
+func ReadManifest(in io.Reader) (*Manifest, error) {
+	man := new(Manifest)
+
+	if err := json.NewDecoder(in).Decode(man); err != nil {
+		return nil, err
+	}
+
+	return man, nil
+}
+
+func (man *Manifest) Write(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(man)
+}
+
+// track runs the build function while collecting manifest data about the written binary.
+func track(
+	ctx context.Context,
+	engine Engine,
+	platform *Platform,
+	mods dependency.Modules,
+	out io.Writer,
+	fn func(man *Manifest, out io.Writer) error,
+) (*Manifest, error) {
+	man := newManifest(ctx, engine, platform, mods)
+
+	counter := &digestWriter{out: out, hash: sha256.New()}
+
+	if err := fn(man, counter); err != nil {
+		return nil, err
+	}
+
+	man.Finished = time.Now().UTC()
+	man.Size = counter.size
+	man.SHA256 = hex.EncodeToString(counter.hash.Sum(nil))
+
+	if reader, ok := out.(io.ReaderAt); ok {
+		if info, ierr := buildinfo.Read(reader); ierr == nil {
+			man.Toolchain["go"] = info.GoVersion
+		}
+	}
+
+	return man, nil
+}
+
+type digestWriter struct {
+	out  io.Writer
+	hash hash.Hash
+	size int64
+}
+
+func (w *digestWriter) Write(p []byte) (int, error) {
+	n, err := w.out.Write(p)
+
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+
+	return n, err
+}
@@ -12,6 +12,8 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"runtime/debug"
+	"sync"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/sirupsen/logrus"
@@ -19,11 +21,26 @@ import (
 	"go.k6.io/xk6"
 )
 
+const (
+	xk6Module = "go.k6.io/xk6"
+
+	envBuildFlags = "XK6_BUILD_FLAGS"
+	envToolchain  = "GOTOOLCHAIN"
+)
+
+// nativeMutex serializes native builds, because they redirect the process wide
+// standard error, log output and environment variables.
+var nativeMutex sync.Mutex //nolint:gochecknoglobals
+
 type nativeBuilder struct {
 	stderr    *os.File
+	null      *os.File
 	logWriter *io.PipeWriter
 	logFlags  int
 	logOutput io.Writer
+	env       map[string]*string
+
+	gotoolchain string
 }
 
 func goVersion() (*semver.Version, bool) {
@@ -63,12 +80,32 @@ func hasGit() bool {
 	return err == nil
 }
 
-func newNativeBuilder(_ context.Context) (Builder, bool, error) {
-	if _, hasGo := goVersion(); !hasGo || !hasGit() {
+func newNativeBuilder(ctx context.Context) (Builder, bool, error) {
+	ver, hasGo := goVersion()
+	if !hasGo || !hasGit() {
+		return nil, false, nil
+	}
+
+	b := new(nativeBuilder)
+
+	constraints := goVersionFromContext(ctx)
+	if constraints == nil || constraints.Check(ver) {
+		return b, true, nil
+	}
+
+	toolchain, err := goToolchain(ctx, ver, constraints)
+	if err != nil {
+		logrus.WithError(err).
+			Warnf("go %s does not satisfy %s, native builder skipped", ver.Original(), constraints.String())
+
 		return nil, false, nil
 	}
 
-	return new(nativeBuilder), true, nil
+	logrus.Debugf("go %s does not satisfy %s, using %s toolchain", ver.Original(), constraints.String(), toolchain)
+
+	b.gotoolchain = toolchain
+
+	return b, true, nil
 }
 
 func (b *nativeBuilder) Engine() Engine {
@@ -80,16 +117,21 @@ func (b *nativeBuilder) Build(
 	platform *Platform,
 	mods dependency.Modules,
 	out io.Writer,
-) error {
+) (*Manifest, error) {
+	nativeMutex.Lock()
+	defer nativeMutex.Unlock()
+
 	b.logFlags = log.Flags()
 	b.logOutput = log.Writer()
 	b.logWriter = logrus.StandardLogger().WriterLevel(logrus.DebugLevel)
 	b.stderr = os.Stderr
+	b.env = make(map[string]*string)
 
 	log.SetOutput(b.logWriter)
 	log.SetFlags(0)
 
 	if null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0); err == nil {
+		b.null = null
 		os.Stderr = null
 	}
 
@@ -99,7 +141,27 @@ func (b *nativeBuilder) Build(
 		platform = RuntimePlatform()
 	}
 
-	return b.build(ctx, platform, mods, out)
+	return track(ctx, b.Engine(), platform, mods, out, func(man *Manifest, out io.Writer) error {
+		b.toolchain(man.Toolchain)
+
+		return b.build(ctx, platform, mods, out)
+	})
+}
+
+func (b *nativeBuilder) toolchain(tools map[string]string) {
+	if len(b.gotoolchain) != 0 {
+		tools["go"] = b.gotoolchain
+	} else if ver, ok := goVersion(); ok {
+		tools["go"] = "go" + ver.Original()
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == xk6Module {
+				tools["xk6"] = dep.Version
+			}
+		}
+	}
 }
 
 func (b *nativeBuilder) close() {
@@ -109,6 +171,32 @@ func (b *nativeBuilder) close() {
 	log.SetOutput(b.logOutput)
 
 	os.Stderr = b.stderr
+
+	if b.null != nil {
+		_ = b.null.Close()
+		b.null = nil
+	}
+
+	for key, value := range b.env {
+		if value != nil {
+			_ = os.Setenv(key, *value)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	}
+}
+
+// setenv sets an environment variable for the duration of the build.
+func (b *nativeBuilder) setenv(key, value string) error {
+	if _, saved := b.env[key]; !saved {
+		if orig, found := os.LookupEnv(key); found {
+			b.env[key] = &orig
+		} else {
+			b.env[key] = nil
+		}
+	}
+
+	return os.Setenv(key, value)
 }
 
 func (b *nativeBuilder) build(
@@ -119,9 +207,22 @@ func (b *nativeBuilder) build(
 ) error {
 	logrus.Debug("Building new k6 binary (native)")
 
+	opts := optionsFromContext(ctx)
+
+	if err := b.setenv(envBuildFlags, opts.buildFlags()); err != nil {
+		return err
+	}
+
+	if len(b.gotoolchain) != 0 {
+		if err := b.setenv(envToolchain, b.gotoolchain); err != nil {
+			return err
+		}
+	}
+
 	builder := new(xk6.Builder)
 
-	builder.Cgo = false
+	builder.Cgo = opts.Cgo
+	builder.RaceDetector = opts.Race
 	builder.OS = platform.OS
 	builder.Arch = platform.Arch
 	builder.Replacements = newReplacements(mods, replacementsFromContext(ctx))
@@ -144,6 +245,8 @@ func (b *nativeBuilder) build(
 		return err
 	}
 
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
 	if err = tmp.Close(); err != nil {
 		return err
 	}
@@ -157,10 +260,9 @@ func (b *nativeBuilder) build(
 		return err
 	}
 
-	_, err = io.Copy(out, tmp)
+	defer tmp.Close() //nolint:errcheck
 
-	tmp.Close()           //nolint:errcheck,gosec
-	os.Remove(tmp.Name()) //nolint:errcheck,gosec
+	_, err = io.Copy(out, tmp)
 
 	return err
 }
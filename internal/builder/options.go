@@ -0,0 +1,266 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+//nolint:revive
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrInvalidOptions = errors.New("invalid build options")
+
+	errTrimpath = errors.New("disabling trimpath is not supported by xk6")
+
+	// tagPattern matches a safe build tag, the tags are passed to xk6 without quoting.
+	tagPattern = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+)
+
+// Options contains go build knobs. The zero value means the default build.
+type Options struct {
+	Cgo        bool     `json:"cgo,omitempty"`
+	Race       bool     `json:"race,omitempty"`
+	NoTrimpath bool     `json:"noTrimpath,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	Ldflags    string   `json:"ldflags,omitempty"`
+}
+
+const (
+	optCgo      = "cgo"
+	optRace     = "race"
+	optTrimpath = "trimpath"
+	optTags     = "tags"
+	optLdflags  = "ldflags"
+
+	defaultLdflags = "-w -s"
+)
+
+// ParseOptions parses build options from query parameters.
+func ParseOptions(query url.Values) (*Options, error) {
+	opts := new(Options)
+
+	for key := range query {
+		var err error
+
+		value := query.Get(key)
+
+		switch key {
+		case optCgo:
+			opts.Cgo, err = strconv.ParseBool(value)
+		case optRace:
+			opts.Race, err = strconv.ParseBool(value)
+		case optTrimpath:
+			var trimpath bool
+
+			trimpath, err = strconv.ParseBool(value)
+			opts.NoTrimpath = !trimpath
+		case optTags:
+			opts.Tags = splitTags(value)
+		case optLdflags:
+			opts.Ldflags = value
+		default:
+			err = fmt.Errorf("unknown option %s", key)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidOptions, err.Error())
+		}
+	}
+
+	opts.normalize()
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// Validate checks whether the options can be safely passed to xk6 in the XK6_BUILD_FLAGS environment variable.
+// xk6 splits the build flags on spaces outside quotes and has no escaping, so the build tags may contain only
+// letters, digits, underscores and dots, and the (quoted) ldflags must not contain quotes or control characters.
+// xk6 always builds with -trimpath, so it can't be disabled.
+func (opts *Options) Validate() error {
+	if opts == nil {
+		return nil
+	}
+
+	if opts.NoTrimpath {
+		return fmt.Errorf("%w: %s", ErrInvalidOptions, errTrimpath.Error())
+	}
+
+	for _, tag := range opts.Tags {
+		if !tagPattern.MatchString(tag) {
+			return fmt.Errorf("%w: invalid build tag: %q", ErrInvalidOptions, tag)
+		}
+	}
+
+	if strings.ContainsAny(opts.Ldflags, "'\"") || strings.IndexFunc(opts.Ldflags, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: invalid ldflags: %q", ErrInvalidOptions, opts.Ldflags)
+	}
+
+	return nil
+}
+
+func splitTags(str string) []string {
+	tags := make([]string, 0)
+
+	for _, tag := range strings.Split(str, ",") {
+		if tag = strings.TrimSpace(tag); len(tag) != 0 {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func (opts *Options) normalize() {
+	sort.Strings(opts.Tags)
+}
+
+// UnmarshalJSON decodes and normalizes the options.
+func (opts *Options) UnmarshalJSON(data []byte) error {
+	type plain Options
+
+	if err := json.Unmarshal(data, (*plain)(opts)); err != nil {
+		return err
+	}
+
+	opts.normalize()
+
+	return nil
+}
+
+// Query returns the non-default options as query parameters.
+func (opts *Options) Query() url.Values {
+	query := make(url.Values)
+
+	if opts == nil {
+		return query
+	}
+
+	if opts.Cgo {
+		query.Set(optCgo, "true")
+	}
+
+	if opts.Race {
+		query.Set(optRace, "true")
+	}
+
+	if opts.NoTrimpath {
+		query.Set(optTrimpath, "false")
+	}
+
+	if len(opts.Tags) != 0 {
+		tags := append([]string{}, opts.Tags...)
+		sort.Strings(tags)
+		query.Set(optTags, strings.Join(tags, ","))
+	}
+
+	if len(opts.Ldflags) != 0 {
+		query.Set(optLdflags, opts.Ldflags)
+	}
+
+	return query
+}
+
+// Encode returns the canonical form of the options, empty for the default build.
+func (opts *Options) Encode() string {
+	return opts.Query().Encode()
+}
+
+func (opts *Options) String() string {
+	return opts.Encode()
+}
+
+func (opts *Options) Default() bool {
+	return len(opts.Encode()) == 0
+}
+
+func (opts *Options) Equal(other *Options) bool {
+	return opts.Encode() == other.Encode()
+}
+
+// args returns the k6x command line flags of the options.
+func (opts *Options) args() []string {
+	args := make([]string, 0)
+
+	if opts == nil {
+		return args
+	}
+
+	if opts.Cgo {
+		args = append(args, "--cgo")
+	}
+
+	if opts.Race {
+		args = append(args, "--race")
+	}
+
+	if opts.NoTrimpath {
+		args = append(args, "--trimpath=false")
+	}
+
+	if len(opts.Tags) != 0 {
+		args = append(args, "--tags", strings.Join(opts.Tags, ","))
+	}
+
+	if len(opts.Ldflags) != 0 {
+		args = append(args, "--ldflags", opts.Ldflags)
+	}
+
+	return args
+}
+
+// buildFlags returns the go build flags in XK6_BUILD_FLAGS format.
+// The ldflags are single quoted, so they may contain spaces (e.g. -X main.a=1 -X main.b=2).
+func (opts *Options) buildFlags() string {
+	var buff strings.Builder
+
+	buff.WriteString("-ldflags='")
+	buff.WriteString(defaultLdflags)
+
+	if opts != nil && len(opts.Ldflags) != 0 {
+		buff.WriteRune(' ')
+		buff.WriteString(opts.Ldflags)
+	}
+
+	buff.WriteRune('\'')
+
+	if opts != nil && len(opts.Tags) != 0 {
+		buff.WriteString(" -tags=")
+		buff.WriteString(strings.Join(opts.Tags, ","))
+	}
+
+	return buff.String()
+}
+
+type optionsKey struct{}
+
+func WithOptions(ctx context.Context, opts *Options) context.Context {
+	return context.WithValue(ctx, optionsKey{}, opts)
+}
+
+func optionsFromContext(ctx context.Context) *Options {
+	v := ctx.Value(optionsKey{})
+	if v == nil {
+		return new(Options)
+	}
+
+	if opts, ok := v.(*Options); ok && opts != nil {
+		return opts
+	}
+
+	return new(Options)
+}
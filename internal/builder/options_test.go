@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package builder_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/k6x/internal/builder"
+)
+
+func TestParseOptions(t *testing.T) {
+	t.Parallel()
+
+	query, err := url.ParseQuery("tags=foo,bar&cgo=true&ldflags=-X%3Dmain.version%3D1")
+	assert.NoError(t, err)
+
+	opts, err := builder.ParseOptions(query)
+	assert.NoError(t, err)
+
+	assert.True(t, opts.Cgo)
+	assert.False(t, opts.Race)
+	assert.Equal(t, []string{"bar", "foo"}, opts.Tags)
+	assert.Equal(t, "-X=main.version=1", opts.Ldflags)
+	assert.Equal(t, "cgo=true&ldflags=-X%3Dmain.version%3D1&tags=bar%2Cfoo", opts.Encode())
+
+	assert.True(t, new(builder.Options).Default())
+	assert.True(t, new(builder.Options).Equal(nil))
+	assert.False(t, opts.Equal(nil))
+
+	_, err = builder.ParseOptions(url.Values{"foo": []string{"bar"}})
+	assert.ErrorIs(t, err, builder.ErrInvalidOptions)
+}
+
+func TestParseOptionsInjection(t *testing.T) {
+	t.Parallel()
+
+	for _, query := range []string{
+		"tags=foo%20-toolexec%3D/x",
+		"tags=foo'",
+		"tags=foo%3Bbar",
+		"ldflags=-X%3Dmain.version%3D1'%20-toolexec%3D/x%20'",
+		"ldflags=-s%22",
+		"ldflags=-s%09-w",
+		"ldflags=-s%0A-w",
+		"trimpath=false",
+	} {
+		values, err := url.ParseQuery(query)
+		assert.NoError(t, err)
+
+		_, err = builder.ParseOptions(values)
+		assert.ErrorIs(t, err, builder.ErrInvalidOptions, query)
+	}
+
+	assert.ErrorIs(t, (&builder.Options{Tags: []string{"a -toolexec=/x"}}).Validate(), builder.ErrInvalidOptions)
+	assert.NoError(t, (&builder.Options{Tags: []string{"foo_bar.baz"}, Ldflags: "-X=main.version=1"}).Validate())
+	assert.NoError(t, (&builder.Options{Ldflags: "-X main.a=1 -X main.b=2"}).Validate())
+	assert.NoError(t, (*builder.Options)(nil).Validate())
+}
+
+func TestBuildFlags(t *testing.T) {
+	t.Parallel()
+
+	opts := &builder.Options{Tags: []string{"bar", "foo"}, Ldflags: "-X main.a=1 -X main.b=2"}
+
+	assert.Equal(t, "-ldflags='-w -s -X main.a=1 -X main.b=2' -tags=bar,foo", builder.BuildFlags(opts))
+	assert.Equal(t, "-ldflags='-w -s'", builder.BuildFlags(nil))
+}
@@ -40,6 +40,21 @@ func (p *Platform) String() string {
 	return p.OS + "/" + p.Arch
 }
 
+func (p *Platform) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Platform) UnmarshalText(text []byte) error {
+	platform, err := ParsePlatform(string(text))
+	if err != nil {
+		return err
+	}
+
+	*p = *platform
+
+	return nil
+}
+
 func (p *Platform) Supported() bool {
 	for _, plat := range supported {
 		if plat.OS == p.OS && plat.Arch == p.Arch {
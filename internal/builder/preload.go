@@ -2,36 +2,252 @@
 //
 // SPDX-License-Identifier: AGPL-3.0-only
 
-//nolint:revive
+//nolint:revive,forbidigo
 package builder
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/szkiba/k6x/internal/dependency"
 )
 
+var (
+	ErrPreload = errors.New("preload failed")
+
+	errInvalidSetName = errors.New("invalid set name")
+)
+
+// PreloadSet is a named set of modules to be preloaded for the given platforms.
+type PreloadSet struct {
+	Name      string             `json:"name,omitempty"`
+	Modules   dependency.Modules `json:"modules"`
+	Platforms []*Platform        `json:"platforms"`
+}
+
+// PreloadResult contains the outcome of preloading a single set for a single platform.
+type PreloadResult struct {
+	Set      string    `json:"set,omitempty"`
+	Platform *Platform `json:"platform"`
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+	Duration string    `json:"duration"`
+	// CacheHit is reported only by the builders with a cache (the service builder).
+	CacheHit *bool  `json:"cacheHit,omitempty"`
+	Output   string `json:"output,omitempty"`
+}
+
+// PreloadReport summarizes a preload run.
+type PreloadReport struct {
+	Sets     []*PreloadSet    `json:"sets"`
+	Duration string           `json:"duration"`
+	Results  []*PreloadResult `json:"results"`
+}
+
+func (rep *PreloadReport) Failed() int {
+	failed := 0
+
+	for _, res := range rep.Results {
+		if !res.Success {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// warmer is implemented by builders able to prepare a k6 binary without transferring it.
+type warmer interface {
+	warmup(ctx context.Context, platform *Platform, mods dependency.Modules) (bool, error)
+}
+
+type preloadTask struct {
+	set      *PreloadSet
+	platform *Platform
+}
+
+// Preload builds k6 binaries for every set and platform concurrently, at most parallel builds at a time.
+// Failed builds do not stop the others, the report contains the outcome of every build.
+// If outdir is not empty, the binaries and their manifests are stored in it.
 func Preload(
 	ctx context.Context,
 	builder Builder,
-	mods dependency.Modules,
-	platforms []*Platform,
-) error {
-	if builder.Engine() == Service {
-		return fmt.Errorf("%w: builder service preload not supported", errNoBuilder)
+	sets []*PreloadSet,
+	parallel int,
+	outdir string,
+) (*PreloadReport, error) {
+	if parallel < 1 {
+		parallel = 1
 	}
 
-	for _, platform := range platforms {
-		logrus.Infof("preloading for %s", platform.String())
+	tasks := make([]*preloadTask, 0, len(sets))
 
-		err := builder.Build(ctx, platform, mods, io.Discard)
-		if err != nil {
-			return err
+	for _, set := range sets {
+		if err := checkSetName(set.Name); err != nil {
+			return nil, err
+		}
+
+		for _, platform := range set.Platforms {
+			tasks = append(tasks, &preloadTask{set: set, platform: platform})
 		}
 	}
 
+	started := time.Now()
+
+	report := &PreloadReport{Sets: sets, Results: make([]*PreloadResult, len(tasks))}
+
+	sem := make(chan struct{}, parallel)
+
+	var wg sync.WaitGroup
+
+	for idx, task := range tasks {
+		wg.Add(1)
+
+		go func(idx int, task *preloadTask) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			report.Results[idx] = preload(ctx, builder, task, outdir)
+		}(idx, task)
+	}
+
+	wg.Wait()
+
+	report.Duration = time.Since(started).Round(time.Millisecond).String()
+
+	if failed := report.Failed(); failed != 0 {
+		return report, fmt.Errorf("%w: %d of %d builds", ErrPreload, failed, len(tasks))
+	}
+
+	return report, nil
+}
+
+// checkSetName checks whether the set name can be used as a directory name in the output directory.
+func checkSetName(name string) error {
+	if strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") || len(filepath.VolumeName(name)) != 0 {
+		return fmt.Errorf("%w: %q", errInvalidSetName, name)
+	}
+
 	return nil
 }
+
+func preload(ctx context.Context, builder Builder, task *preloadTask, outdir string) *PreloadResult {
+	log := logrus.WithField("platform", task.platform.String())
+	if len(task.set.Name) != 0 {
+		log = log.WithField("set", task.set.Name)
+	}
+
+	log.Infof("preloading for %s", task.platform.String())
+
+	result := &PreloadResult{Set: task.set.Name, Platform: task.platform}
+
+	started := time.Now()
+
+	var (
+		err error
+		hit bool
+	)
+
+	w, cached := builder.(warmer)
+
+	if cached && len(outdir) == 0 {
+		hit, err = w.warmup(ctx, task.platform, task.set.Modules)
+	} else {
+		var man *Manifest
+
+		if man, err = preloadBuild(ctx, builder, task, outdir, result); err == nil {
+			hit = man.Cached
+			started = buildStarted(man, started)
+		}
+	}
+
+	if cached && err == nil {
+		result.CacheHit = &hit
+	}
+
+	result.Duration = time.Since(started).Round(time.Millisecond).String()
+
+	if err != nil {
+		log.WithError(err).Error("preload error")
+
+		result.Error = err.Error()
+
+		return result
+	}
+
+	result.Success = true
+
+	return result
+}
+
+// buildStarted returns the start of the build recorded in the manifest, so the duration doesn't include
+// the waiting for the build (e.g. the native builds are serialized). For cached binaries it returns def.
+func buildStarted(man *Manifest, def time.Time) time.Time {
+	if man.Cached || man.Started.IsZero() || man.Started.Before(def) {
+		return def
+	}
+
+	return man.Started
+}
+
+func preloadBuild(
+	ctx context.Context,
+	builder Builder,
+	task *preloadTask,
+	outdir string,
+	result *PreloadResult,
+) (man *Manifest, err error) {
+	if len(outdir) == 0 {
+		return builder.Build(ctx, task.platform, task.set.Modules, io.Discard)
+	}
+
+	dir := filepath.Join(outdir, task.set.Name, task.platform.OS+"-"+task.platform.Arch)
+	if err = os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	result.Output = filepath.Join(dir, "k6")
+	if task.platform.OS == "windows" {
+		result.Output += ".exe"
+	}
+
+	file, err := os.OpenFile(result.Output, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o755) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	man, err = builder.Build(ctx, task.platform, task.set.Modules, file)
+
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(result.Output) //nolint:errcheck,gosec
+
+		return nil, err
+	}
+
+	mfile, err := os.Create(ManifestFile(result.Output))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if cerr := mfile.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	return man, man.Write(mfile)
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package builder_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/k6x/internal/builder"
+	"github.com/szkiba/k6x/internal/dependency"
+)
+
+type testBuilder struct{}
+
+func (testBuilder) Build(
+	_ context.Context,
+	platform *builder.Platform,
+	mods dependency.Modules,
+	out io.Writer,
+) (*builder.Manifest, error) {
+	_, err := io.WriteString(out, "k6")
+
+	return &builder.Manifest{Platform: platform, Modules: mods}, err
+}
+
+func (testBuilder) Engine() builder.Engine {
+	return builder.Native
+}
+
+func TestPreloadSetName(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	outdir := filepath.Join(root, "out")
+	platforms := []*builder.Platform{{OS: "linux", Arch: "amd64"}}
+
+	for _, name := range []string{"../../x", "..", "a/b", `a\b`, "/x"} {
+		sets := []*builder.PreloadSet{{Name: name, Platforms: platforms}}
+
+		_, err := builder.Preload(context.Background(), testBuilder{}, sets, 1, outdir)
+		assert.Error(t, err, name)
+	}
+
+	entries, err := os.ReadDir(root)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	sets := []*builder.PreloadSet{{Name: "basic", Platforms: platforms}}
+
+	report, err := builder.Preload(context.Background(), testBuilder{}, sets, 1, outdir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(outdir, "basic", "linux-amd64", "k6"), report.Results[0].Output)
+	assert.FileExists(t, report.Results[0].Output)
+}
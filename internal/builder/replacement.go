@@ -53,6 +53,24 @@ func (reps Replacements) MarshalJSON() ([]byte, error) {
 	return json.Marshal(dict)
 }
 
+func (reps *Replacements) UnmarshalJSON(data []byte) error {
+	dict := make(map[string]string)
+
+	if err := json.Unmarshal(data, &dict); err != nil {
+		return err
+	}
+
+	if *reps == nil {
+		*reps = make(Replacements, len(dict))
+	}
+
+	for name, path := range dict {
+		(*reps)[name] = NewReplacement(name, path)
+	}
+
+	return nil
+}
+
 type replacementsKey struct{}
 
 func WithReplacements(ctx context.Context, reps Replacements) context.Context {
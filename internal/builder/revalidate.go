@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package builder
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/szkiba/k6x/internal/dependency"
+)
+
+// revalidator is implemented by builders able to check whether a previously built k6 binary is still valid.
+type revalidator interface {
+	revalidate(ctx context.Context, platform *Platform, mods dependency.Modules, checksum string) (bool, error)
+}
+
+// Revalidate checks whether the k6 binary built earlier with the given SHA-256 checksum (hex encoded)
+// is still valid. Builders without revalidation support (and binaries without checksum) are always valid.
+func Revalidate(
+	ctx context.Context,
+	builder Builder,
+	platform *Platform,
+	mods dependency.Modules,
+	checksum string,
+) (bool, error) {
+	if r, ok := builder.(revalidator); ok && len(checksum) != 0 {
+		return r.revalidate(ctx, platform, mods, checksum)
+	}
+
+	return true, nil
+}
+
+// revalidate sends a HEAD request to the service, the binary is valid if the checksum of the binary
+// served by the service is the same. Services without checksum header can't be revalidated,
+// their binaries are always valid.
+func (b *serviceBuilder) revalidate(
+	ctx context.Context,
+	platform *Platform,
+	mods dependency.Modules,
+	checksum string,
+) (bool, error) {
+	var valid bool
+
+	err := b.failover(ctx, func(ep *serviceEndpoint) error {
+		req, err := b.request(ctx, ep, http.MethodHead, servicePath(ctx, platform, mods))
+		if err != nil {
+			return err
+		}
+
+		resp, err := b.send(req)
+		if err != nil {
+			return err
+		}
+
+		defer resp.Body.Close() //nolint:errcheck
+
+		if resp.StatusCode != http.StatusOK {
+			return statusError(resp)
+		}
+
+		served := resp.Header.Get(serviceChecksumHeader)
+		valid = len(served) == 0 || strings.EqualFold(served, checksum)
+
+		return nil
+	})
+
+	return valid, err
+}
@@ -6,38 +6,194 @@ package builder
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
-	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/szkiba/k6x/internal/dependency"
 )
 
-const serviceTimeout = 60 * time.Second
+const (
+	serviceTimeout      = 60 * time.Second
+	servicePollInterval = 2 * time.Second
+
+	serviceDownloadAttempts = 5
+	serviceRetryAttempts    = 5
+	serviceRetryBackoff     = time.Second
+	serviceMaxRetryDelay    = 5 * time.Minute
+	serviceJobsPrefix       = "/jobs"
+)
 
 var (
 	errService         = errors.New("service error")
-	errServiceEndpoint = errors.New("missing build service endpoint")
+	errServiceJobs     = errors.New("build service does not support jobs")
+	errServiceTLS      = errors.New("invalid build service TLS config")
+	errServicePlatform = errors.New("platform is not supported by the build service")
+
+	errDownloadInterrupted = errors.New("download interrupted")
 )
 
 type serviceBuilder struct {
-	client *http.Client
+	client    *http.Client
+	publicKey ed25519.PublicKey
+	endpoints []*serviceEndpoint
+	token     string
+
+	mu     sync.Mutex
+	active int
+}
+
+// ServiceConfig contains the settings of the build service client.
+type ServiceConfig struct {
+	// Endpoints lists the build service endpoints, in order of preference.
+	Endpoints []string `yaml:"endpoints"`
+	// Strategy is the endpoint selection strategy: order (default) or latency.
+	Strategy string `yaml:"strategy"`
+	// Token is the bearer token of the client.
+	Token string `yaml:"token"`
+	// CA is the CA bundle file (PEM) for verifying the certificate of the build service.
+	CA string `yaml:"ca"`
+	// Cert is the client certificate file (PEM) for mutual TLS authentication.
+	Cert string `yaml:"cert"`
+	// Key is the private key file (PEM) of the client certificate.
+	Key string `yaml:"key"`
+	// PublicKey is the trusted public key file (PEM), only signed k6 binaries are accepted if set.
+	PublicKey string `yaml:"publicKey"`
+}
+
+// serviceConfigFromEnv returns the build service client settings from the K6X_BUILDER_SERVICE* environment variables.
+func serviceConfigFromEnv() *ServiceConfig {
+	return &ServiceConfig{
+		Endpoints: serviceEndpoints(),
+		Strategy:  os.Getenv("K6X_BUILDER_SERVICE_STRATEGY"),   //nolint:forbidigo
+		Token:     os.Getenv("K6X_BUILDER_SERVICE_TOKEN"),      //nolint:forbidigo
+		CA:        os.Getenv("K6X_BUILDER_SERVICE_CA"),         //nolint:forbidigo
+		Cert:      os.Getenv("K6X_BUILDER_SERVICE_CERT"),       //nolint:forbidigo
+		Key:       os.Getenv("K6X_BUILDER_SERVICE_KEY"),        //nolint:forbidigo
+		PublicKey: os.Getenv("K6X_BUILDER_SERVICE_PUBLIC_KEY"), //nolint:forbidigo
+	}
 }
 
 func newServiceBuilder(ctx context.Context) (Builder, bool, error) {
-	if buildServiceDisabled(ctx) {
+	b, err := newConfiguredServiceBuilder(ctx, serviceConfigFromEnv())
+	if b == nil || err != nil {
+		return nil, false, err
+	}
+
+	if !b.available() {
+		logrus.Warn("no build service endpoint is available, service builder skipped")
+
 		return nil, false, nil
 	}
 
+	logrus.Infof("using build service %s", b.endpoints[0].url)
+
+	return b, true, nil
+}
+
+// NewServiceBuilder returns a builder using the build service with the given settings
+// (e.g. an upstream build service of a proxy). The builder is returned even if no endpoint
+// is available at the moment, the unavailable endpoints are probed again on demand.
+func NewServiceBuilder(ctx context.Context, cfg *ServiceConfig) (Builder, error) {
+	b, err := newConfiguredServiceBuilder(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if b == nil {
+		return nil, fmt.Errorf("%w: no endpoint", errServiceUnavailable)
+	}
+
+	if !b.available() {
+		logrus.Warn("no build service endpoint is available, endpoints will be probed on demand")
+	} else {
+		logrus.Infof("using build service %s", b.endpoints[0].url)
+	}
+
+	return b, nil
+}
+
+// newConfiguredServiceBuilder returns the service builder with the probed endpoints, or nil if there is no endpoint.
+func newConfiguredServiceBuilder(ctx context.Context, cfg *ServiceConfig) (*serviceBuilder, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	tlsConfig, err := serviceTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := servicePublicKey(cfg.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
 	client := &http.Client{Timeout: serviceTimeout}
 
-	return &serviceBuilder{client: client}, true, nil
+	if tlsConfig != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+		transport.TLSClientConfig = tlsConfig
+		client.Transport = transport
+	}
+
+	strategy, err := serviceStrategy(cfg.Strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &serviceBuilder{client: client, publicKey: publicKey, token: cfg.Token}
+
+	b.endpoints = b.discover(ctx, cfg.Endpoints, strategy)
+
+	return b, nil
+}
+
+// serviceTLSConfig returns the TLS config with the custom CA bundle
+// and client certificate of the builder service, if any.
+func serviceTLSConfig(cfg *ServiceConfig) (*tls.Config, error) {
+	caFile, certFile, keyFile := cfg.CA, cfg.Cert, cfg.Key
+
+	if len(caFile) == 0 && len(certFile) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(caFile) != 0 {
+		pem, err := os.ReadFile(caFile) //nolint:forbidigo
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errServiceTLS, err.Error())
+		}
+
+		config.RootCAs = x509.NewCertPool()
+
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates in %s", errServiceTLS, caFile)
+		}
+	}
+
+	if len(certFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errServiceTLS, err.Error())
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
 }
 
 func (b *serviceBuilder) Engine() Engine {
@@ -49,82 +205,452 @@ func (b *serviceBuilder) Build(
 	platform *Platform,
 	mods dependency.Modules,
 	out io.Writer,
-) error {
+) (*Manifest, error) {
 	if platform == nil {
 		platform = RuntimePlatform()
 	}
 
-	return b.build(ctx, platform, mods, out)
-}
+	return track(ctx, b.Engine(), platform, mods, out, func(man *Manifest, out io.Writer) error {
+		return b.failover(ctx, func(ep *serviceEndpoint) error {
+			man.Toolchain["service"] = ep.url
 
-func builderService() string {
-	return os.Getenv("K6X_BUILDER_SERVICE") //nolint:forbidigo
+			return b.build(ctx, ep, platform, mods, man, out)
+		})
+	})
 }
 
-func buildServiceDisabled(ctx context.Context) bool {
-	loc := builderService()
-	if len(loc) == 0 {
-		return true
-	}
+func (b *serviceBuilder) build(
+	ctx context.Context,
+	ep *serviceEndpoint,
+	platform *Platform,
+	mods dependency.Modules,
+	man *Manifest,
+	out io.Writer,
+) error {
+	logrus.Debug("Building new k6 binary (service)")
 
-	u, err := url.Parse(loc)
-	if err != nil {
-		return false
+	if !ep.supports(platform) {
+		return fmt.Errorf("%w: %s", errServicePlatform, platform.String())
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
-	defer cancel()
+	path := servicePath(ctx, platform, mods)
 
-	var r net.Resolver
+	job, err := b.submit(ctx, ep, path)
+	if errors.Is(err, errServiceJobs) {
+		return b.download(ctx, ep, http.MethodGet, path, path, man, out)
+	}
 
-	txts, err := r.LookupTXT(ctx, u.Hostname())
 	if err != nil {
-		return false
+		return err
 	}
 
-	for _, txt := range txts {
-		if txt == "disabled=true" {
-			return true
-		}
+	if job, err = b.wait(ctx, ep, job); err != nil {
+		return err
 	}
 
-	return false
+	return b.download(ctx, ep, http.MethodGet, job.Artifact, path, man, out)
 }
 
-func (b *serviceBuilder) build(
+// warmup asks the service to build the k6 binary without downloading it.
+func (b *serviceBuilder) warmup(ctx context.Context, platform *Platform, mods dependency.Modules) (bool, error) {
+	var cached bool
+
+	err := b.failover(ctx, func(ep *serviceEndpoint) error {
+		var err error
+
+		cached, err = b.warmupEndpoint(ctx, ep, platform, mods)
+
+		return err
+	})
+
+	return cached, err
+}
+
+func (b *serviceBuilder) warmupEndpoint(
 	ctx context.Context,
+	ep *serviceEndpoint,
 	platform *Platform,
 	mods dependency.Modules,
+) (bool, error) {
+	logrus.Debug("Warming up k6 binary (service)")
+
+	if !ep.supports(platform) {
+		return false, fmt.Errorf("%w: %s", errServicePlatform, platform.String())
+	}
+
+	path := servicePath(ctx, platform, mods)
+
+	job, err := b.submit(ctx, ep, path)
+	if errors.Is(err, errServiceJobs) {
+		man := new(Manifest)
+
+		err = b.download(ctx, ep, http.MethodHead, path, path, man, io.Discard)
+
+		return man.Cached, err
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if job, err = b.wait(ctx, ep, job); err != nil {
+		return false, err
+	}
+
+	return job.Cached, nil
+}
+
+// download retrieves the k6 binary from the given path of the service, the signature of the k6 binary
+// is verified for the canonical build path. The (possibly compressed) response body is downloaded into
+// a temporary file first, and an interrupted download is resumed using a range request.
+func (b *serviceBuilder) download(
+	ctx context.Context,
+	ep *serviceEndpoint,
+	method string,
+	path string,
+	canonical string,
+	man *Manifest,
 	out io.Writer,
 ) error {
-	logrus.Debug("Building new k6 binary (service)")
+	tmp, err := os.CreateTemp("", "k6x-*.download") //nolint:forbidigo
+	if err != nil {
+		return err
+	}
 
-	service := builderService()
-	if len(service) == 0 {
-		return errServiceEndpoint
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name()) //nolint:forbidigo
+	}()
+
+	state := &downloadState{file: tmp}
+
+	for attempt := 1; ; attempt++ {
+		err = b.fetch(ctx, ep, method, path, man, state)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, errDownloadInterrupted) || ctx.Err() != nil || attempt >= serviceDownloadAttempts {
+			return err
+		}
+
+		logrus.WithError(err).Debugf("Resuming download from %d bytes", state.written)
 	}
 
-	path := "/" + platform.String() + "/" + mods.ToArtifacts().String()
+	if method == http.MethodHead {
+		return nil
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, service+path, nil)
-	if err != nil {
+	if err = state.verify(b.publicKey, canonical); err != nil {
 		return err
 	}
 
-	resp, err := b.client.Do(req)
+	return state.decode(out)
+}
+
+// downloadState contains the progress of a resumable download.
+type downloadState struct {
+	file      *os.File
+	written   int64
+	etag      string
+	encoding  string
+	checksum  string
+	signature string
+}
+
+// decode writes the decompressed content of the downloaded file to out.
+func (state *downloadState) decode(out io.Writer) error {
+	if _, err := state.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	body, err := decodeBody(state.encoding, state.file)
 	if err != nil {
 		return fmt.Errorf("%w: %s", errService, err.Error())
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%w: %s", errService, resp.Status)
+	defer body.Close() //nolint:errcheck
+
+	_, err = io.Copy(out, body)
+
+	return err
+}
+
+func (state *downloadState) reset() error {
+	state.written = 0
+	state.etag = ""
+	state.encoding = ""
+	state.checksum = ""
+	state.signature = ""
+
+	if err := state.file.Truncate(0); err != nil {
+		return err
 	}
 
-	defer resp.Body.Close() //nolint:errcheck
+	_, err := state.file.Seek(0, io.SeekStart)
+
+	return err
+}
 
-	if _, err = io.Copy(out, resp.Body); err != nil {
+// fetch downloads the response body into the file of the state, continuing the previous attempt if possible.
+func (b *serviceBuilder) fetch(ctx context.Context, ep *serviceEndpoint, method string, path string, man *Manifest, state *downloadState) error {
+	req, err := b.request(ctx, ep, method, path)
+	if err != nil {
 		return err
 	}
 
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+
+	resuming := state.written != 0 && len(state.etag) != 0
+	if resuming {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", state.written))
+		req.Header.Set("If-Range", state.etag)
+	}
+
+	resp, err := b.send(req)
+	if err != nil {
+		if resuming {
+			return fmt.Errorf("%w: %s", errDownloadInterrupted, err.Error())
+		}
+
+		return err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		if err := state.reset(); err != nil {
+			return err
+		}
+
+		state.etag = resp.Header.Get("ETag")
+		state.encoding = resp.Header.Get("Content-Encoding")
+		state.checksum = resp.Header.Get(serviceChecksumHeader)
+		state.signature = resp.Header.Get(serviceSignatureHeader)
+		man.Cached = man.Cached || cachedResponse(resp)
+	case resp.StatusCode == http.StatusPartialContent && resuming:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", state.written)) {
+			if err := state.reset(); err != nil {
+				return err
+			}
+
+			return fmt.Errorf("%w: unexpected content range", errDownloadInterrupted)
+		}
+	default:
+		return statusError(resp)
+	}
+
+	if method == http.MethodHead {
+		return nil
+	}
+
+	n, err := io.Copy(state.file, resp.Body)
+
+	state.written += n
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", errDownloadInterrupted, err.Error())
+	}
+
 	return nil
 }
+
+// statusError returns the error of an unexpected response status, server errors make the endpoint unavailable.
+func statusError(resp *http.Response) error {
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%w: %w: %s", errService, errServiceUnavailable, resp.Status)
+	}
+
+	return fmt.Errorf("%w: %s", errService, resp.Status)
+}
+
+// serviceJob is the status of an asynchronous build job of the service.
+type serviceJob struct {
+	ID       string   `json:"id"`
+	Status   string   `json:"status"`
+	Error    string   `json:"error"`
+	Cached   bool     `json:"cached"`
+	Log      []string `json:"log"`
+	Artifact string   `json:"artifact"`
+}
+
+// submit starts an asynchronous build job. Returns errServiceJobs if the service does not support jobs.
+func (b *serviceBuilder) submit(ctx context.Context, ep *serviceEndpoint, path string) (*serviceJob, error) {
+	resp, err := b.do(ctx, ep, http.MethodPost, serviceJobsPrefix+path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return nil, errServiceJobs
+	default:
+		return nil, statusError(resp)
+	}
+
+	job := new(serviceJob)
+
+	if err := json.NewDecoder(resp.Body).Decode(job); err != nil {
+		return nil, fmt.Errorf("%w: %s", errService, err.Error())
+	}
+
+	return job, nil
+}
+
+// wait polls the status of the job until it is finished.
+func (b *serviceBuilder) wait(ctx context.Context, ep *serviceEndpoint, job *serviceJob) (*serviceJob, error) {
+	seen := 0
+
+	for {
+		seen = logJob(job, seen)
+
+		switch job.Status {
+		case "done":
+			return job, nil
+		case "failed":
+			return nil, fmt.Errorf("%w: %s", errService, job.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(servicePollInterval):
+		}
+
+		next, err := b.poll(ctx, ep, job.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		job = next
+	}
+}
+
+func (b *serviceBuilder) poll(ctx context.Context, ep *serviceEndpoint, id string) (*serviceJob, error) {
+	resp, err := b.do(ctx, ep, http.MethodGet, serviceJobsPrefix+"/"+id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	job := new(serviceJob)
+
+	if err := json.NewDecoder(resp.Body).Decode(job); err != nil {
+		return nil, fmt.Errorf("%w: %s", errService, err.Error())
+	}
+
+	return job, nil
+}
+
+// logJob logs the job log lines not seen yet, returns the number of lines seen.
+func logJob(job *serviceJob, seen int) int {
+	if seen > len(job.Log) {
+		seen = 0
+	}
+
+	for _, line := range job.Log[seen:] {
+		logrus.WithField("job", job.ID).Debug(line)
+	}
+
+	return len(job.Log)
+}
+
+func (b *serviceBuilder) do(ctx context.Context, ep *serviceEndpoint, method string, path string) (*http.Response, error) {
+	req, err := b.request(ctx, ep, method, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.send(req)
+}
+
+func (b *serviceBuilder) request(ctx context.Context, ep *serviceEndpoint, method string, path string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, ep.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b.token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+
+	return req, nil
+}
+
+// send sends the request, rate limited requests (429) are retried after the delay requested by the service.
+func (b *serviceBuilder) send(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := b.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w: %s", errService, errServiceUnavailable, err.Error())
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= serviceRetryAttempts {
+			return resp, nil
+		}
+
+		delay := retryDelay(resp, attempt)
+
+		resp.Body.Close() //nolint:errcheck,gosec
+
+		logrus.Debugf("Build service request limit exceeded, retrying after %s", delay)
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+
+		req = req.Clone(req.Context())
+	}
+}
+
+// retryDelay returns the delay before retrying a rate limited request: the Retry-After delay
+// (in seconds or as HTTP date), but at least the exponential backoff delay of the attempt.
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	delay := serviceRetryBackoff << attempt
+
+	value := resp.Header.Get("Retry-After")
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if after := time.Duration(secs) * time.Second; after > delay {
+			delay = after
+		}
+	} else if date, err := http.ParseTime(value); err == nil {
+		if after := time.Until(date); after > delay {
+			delay = after
+		}
+	}
+
+	if delay > serviceMaxRetryDelay {
+		delay = serviceMaxRetryDelay
+	}
+
+	return delay
+}
+
+// servicePath returns the canonical build path of the k6 binary.
+func servicePath(ctx context.Context, platform *Platform, mods dependency.Modules) string {
+	path := "/" + platform.String() + "/" + mods.ToArtifacts().String()
+
+	if query := optionsFromContext(ctx).Encode(); len(query) != 0 {
+		path += "?" + query
+	}
+
+	return path
+}
+
+// cachedResponse checks whether the response was served from a cache instead of a fresh build.
+func cachedResponse(resp *http.Response) bool {
+	return len(resp.Header.Get("Age")) != 0 ||
+		strings.HasPrefix(strings.ToUpper(resp.Header.Get("X-Cache")), "HIT")
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+//nolint:revive
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+const (
+	goReleasesURL     = "https://go.dev/dl/?mode=json&include=all"
+	goReleasesTimeout = 10 * time.Second
+)
+
+var (
+	errToolchainSwitch = errors.New("go toolchain switching requires go 1.21 or later")
+	errNoToolchain     = errors.New("no go toolchain satisfies the constraints")
+
+	minToolchainSwitch = semver.MustParse("1.21.0") //nolint:gochecknoglobals
+)
+
+type goRelease struct {
+	Version string `json:"version"`
+	Stable  bool   `json:"stable"`
+}
+
+// goToolchain returns the GOTOOLCHAIN value of the latest go release satisfying the constraints.
+func goToolchain(ctx context.Context, current *semver.Version, constraints *semver.Constraints) (string, error) {
+	if current.LessThan(minToolchainSwitch) {
+		return "", errToolchainSwitch
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, goReleasesTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, goReleasesURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %s", errNoToolchain, resp.Status)
+	}
+
+	var releases []*goRelease
+
+	if err = json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return "", err
+	}
+
+	var found *semver.Version
+
+	name := ""
+
+	for _, rel := range releases {
+		if !rel.Stable {
+			continue
+		}
+
+		ver, err := semver.NewVersion(strings.TrimPrefix(rel.Version, "go"))
+		if err != nil || ver.LessThan(minToolchainSwitch) || !constraints.Check(ver) {
+			continue
+		}
+
+		if found == nil || ver.GreaterThan(found) {
+			found = ver
+			name = rel.Version
+		}
+	}
+
+	if found == nil {
+		return "", fmt.Errorf("%w: %s", errNoToolchain, constraints.String())
+	}
+
+	return name, nil
+}
+
+type goVersionKey struct{}
+
+// WithGoVersion sets the go toolchain version constraints required for builds.
+func WithGoVersion(ctx context.Context, constraints *semver.Constraints) context.Context {
+	return context.WithValue(ctx, goVersionKey{}, constraints)
+}
+
+func goVersionFromContext(ctx context.Context) *semver.Constraints {
+	if constraints, ok := ctx.Value(goVersionKey{}).(*semver.Constraints); ok {
+		return constraints
+	}
+
+	return nil
+}
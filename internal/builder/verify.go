@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package builder
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	serviceChecksumHeader  = "X-Checksum-Sha256"
+	serviceSignatureHeader = "X-Signature-Ed25519"
+)
+
+var (
+	errServiceChecksum  = errors.New("build service checksum mismatch")
+	errServiceSignature = errors.New("invalid build service signature")
+	errServicePublicKey = errors.New("invalid build service public key")
+)
+
+// servicePublicKey reads the trusted public key of the builder service from the file, if any.
+// If the public key is set, only signed k6 binaries are accepted from the service.
+func servicePublicKey(filename string) (ed25519.PublicKey, error) {
+	if len(filename) == 0 {
+		return nil, nil
+	}
+
+	src, err := os.ReadFile(filename) //nolint:forbidigo
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errServicePublicKey, err.Error())
+	}
+
+	block, _ := pem.Decode(src)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data in %s", errServicePublicKey, filename)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errServicePublicKey, err.Error())
+	}
+
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an Ed25519 key", errServicePublicKey)
+	}
+
+	return publicKey, nil
+}
+
+// SignedMessage returns the message signed by the build service: the SHA-256 digest of the k6 binary
+// followed by the canonical build path (e.g. /linux/amd64/k6@v0.46.0). The build path is signed too,
+// so a signed k6 binary can't be passed off as the k6 binary of other build parameters.
+func SignedMessage(digest []byte, path string) []byte {
+	msg := make([]byte, 0, len(digest)+len(path))
+	msg = append(msg, digest...)
+
+	return append(msg, path...)
+}
+
+// verify checks the downloaded k6 binary against the checksum and signature sent by the service.
+// The signature must be valid for the requested build path (see SignedMessage).
+// Binaries without checksum are accepted only if there is no trusted public key.
+func (state *downloadState) verify(publicKey ed25519.PublicKey, path string) error {
+	if len(state.checksum) == 0 {
+		if publicKey != nil {
+			return fmt.Errorf("%w: missing checksum", errServiceSignature)
+		}
+
+		return nil
+	}
+
+	expected, err := hex.DecodeString(state.checksum)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errServiceChecksum, err.Error())
+	}
+
+	hash := sha256.New()
+
+	if err = state.decode(hash); err != nil {
+		return err
+	}
+
+	digest := hash.Sum(nil)
+
+	if subtle.ConstantTimeCompare(digest, expected) != 1 {
+		return errServiceChecksum
+	}
+
+	if publicKey == nil {
+		return nil
+	}
+
+	if len(state.signature) == 0 {
+		return fmt.Errorf("%w: missing signature", errServiceSignature)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(state.signature)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errServiceSignature, err.Error())
+	}
+
+	if !ed25519.Verify(publicKey, SignedMessage(digest, path), sig) {
+		return errServiceSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// auditBackups is the number of rotated audit log files kept.
+const auditBackups = 5
+
+// openAuditLog returns the audit log sink of the service, or nil if the audit log is disabled.
+func (opts *options) openAuditLog(stdout io.Writer) (io.WriteCloser, error) {
+	switch opts.auditLog {
+	case "":
+		return nil, nil //nolint:nilnil
+	case "-":
+		return nopCloser{stdout}, nil
+	default:
+		return openRotatingFile(opts.auditLog, opts.auditRotate, auditBackups)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// rotatingFile is an append-only file, which is rotated when its size exceeds the limit.
+// The rotated files are suffixed with a sequence number (.1 is the most recent).
+type rotatingFile struct {
+	name    string
+	limit   int64
+	backups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(name string, limit int64, backups int) (*rotatingFile, error) {
+	rf := &rotatingFile{name: name, limit: limit, backups: backups}
+
+	if err := rf.open(name); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *rotatingFile) open(name string) error {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600) //nolint:forbidigo
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return err
+	}
+
+	rf.file, rf.size = file, info.Size()
+
+	return nil
+}
+
+// Write writes data to the file, after rotating the file if the size limit would be exceeded.
+// If the rotation fails, the data is still written to the current file.
+func (rf *rotatingFile) Write(data []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file != nil && rf.limit > 0 && rf.size > 0 && rf.size+int64(len(data)) > rf.limit {
+		if err := rf.rotate(); err != nil {
+			logrus.WithError(err).Warn("audit log rotation error")
+		}
+	}
+
+	// the file is missing only if even the recovery of a failed rotation failed
+	if rf.file == nil {
+		if err := rf.open(rf.name); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(data)
+
+	rf.size += int64(n)
+
+	return n, err
+}
+
+// rotate shifts the rotated files and reopens the file. Must be called with mu held.
+// If the rotation fails, the original file is reopened.
+func (rf *rotatingFile) rotate() error {
+	err := rf.file.Close()
+
+	rf.file = nil
+
+	if err != nil {
+		return rf.recover(rf.name, err)
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", rf.name, rf.backups)) //nolint:forbidigo
+
+	for idx := rf.backups - 1; idx > 0; idx-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", rf.name, idx), fmt.Sprintf("%s.%d", rf.name, idx+1)) //nolint:forbidigo
+	}
+
+	if err := os.Rename(rf.name, rf.name+".1"); err != nil { //nolint:forbidigo
+		return rf.recover(rf.name, err)
+	}
+
+	if err := rf.open(rf.name); err != nil {
+		// the original file has already been renamed
+		return rf.recover(rf.name+".1", err)
+	}
+
+	return nil
+}
+
+// recover reopens the original file after a failed rotation, and returns the cause of the failure.
+func (rf *rotatingFile) recover(name string, cause error) error {
+	if err := rf.open(name); err != nil {
+		return errors.Join(cause, err)
+	}
+
+	return cause
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+
+	return rf.file.Close()
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "audit.log")
+
+	rf, err := openRotatingFile(name, 6, 2)
+	assert.NoError(t, err)
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = rf.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, rf.Close())
+
+	content := func(name string) string {
+		data, err := os.ReadFile(name)
+		assert.NoError(t, err)
+
+		return string(data)
+	}
+
+	assert.Equal(t, "fourth\n", content(name))
+	assert.Equal(t, "third\n", content(name+".1"))
+	assert.Equal(t, "second\n", content(name+".2"))
+	assert.NoFileExists(t, name+".3")
+}
+
+func TestRotatingFileFailure(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "audit.log")
+
+	// the rotated file can't be renamed to a non-empty directory
+	assert.NoError(t, os.MkdirAll(filepath.Join(name+".1", "dir"), 0o750))
+
+	rf, err := openRotatingFile(name, 6, 1)
+	assert.NoError(t, err)
+
+	for _, line := range []string{"first\n", "second\n"} {
+		_, err = rf.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, rf.Close())
+
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", string(data))
+}
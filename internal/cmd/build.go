@@ -9,7 +9,9 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
 	"github.com/szkiba/k6x/internal/builder"
@@ -28,28 +30,24 @@ func prepare(
 		if err := opts.dirs.fs.Remove(cmd); err != nil {
 			return err
 		}
-	}
 
-	var fulfill bool
+		opts.dirs.fs.Remove(builder.ManifestFile(cmd)) //nolint:errcheck,gosec
+	}
 
 	if exists(cmd, opts.dirs.fs) {
-		cmdres := resolver.FromCommand(cmd, "version")
-		bings, err := cmdres.Resolve(ctx, deps)
+		mods, man, err := installedModules(ctx, cmd, opts.dirs.fs)
 		if err != nil {
 			return err
 		}
 
-		fulfill = bings.Resolves(deps)
-	}
+		if mods.Resolves(deps) && upToDate(man, opts) {
+			return nil
+		}
 
-	if fulfill {
-		return nil
-	}
+		cmdeps := make(dependency.Dependencies, len(mods))
 
-	if exists(cmd, opts.dirs.fs) {
-		cmdeps, err := resolver.CommandDependencies(ctx, cmd, "version")
-		if err != nil {
-			return err
+		for name := range mods {
+			cmdeps[name] = &dependency.Dependency{Name: name}
 		}
 
 		addOptional(ctx, res, deps, cmdeps)
@@ -58,6 +56,94 @@ func prepare(
 	return build(ctx, deps, res, opts)
 }
 
+// installedModules returns the modules included in the cached k6 binary and its manifest.
+// The sidecar manifest is used if it is up to date, otherwise the binary's version command is executed
+// and nil manifest is returned.
+func installedModules(
+	ctx context.Context,
+	cmd string,
+	afs afero.Fs,
+) (dependency.Modules, *builder.Manifest, error) {
+	if man, fresh := readManifest(cmd, afs); fresh {
+		logrus.Debugf("using manifest of %s", cmd)
+
+		return man.Modules, man, nil
+	}
+
+	mods, err := resolver.CommandModules(ctx, cmd, "version")
+
+	return mods, nil, err
+}
+
+// upToDate checks whether the cached k6 binary was built with the requested build options and go toolchain.
+// Without manifest the default build options and unknown go toolchain are assumed.
+func upToDate(man *builder.Manifest, opts *options) bool {
+	var bopts *builder.Options
+
+	if man != nil {
+		bopts = man.Options
+	}
+
+	if !bopts.Equal(opts.bopts) {
+		return false
+	}
+
+	if opts.goVer == nil {
+		return true
+	}
+
+	if man == nil {
+		return false
+	}
+
+	ver, err := semver.NewVersion(strings.TrimPrefix(man.Toolchain["go"], "go"))
+
+	return err == nil && opts.goVer.Check(ver)
+}
+
+func readManifest(cmd string, afs afero.Fs) (*builder.Manifest, bool) {
+	bin, err := afs.Stat(cmd)
+	if err != nil {
+		return nil, false
+	}
+
+	name := builder.ManifestFile(cmd)
+
+	info, err := afs.Stat(name)
+	if err != nil || info.ModTime().Before(bin.ModTime()) {
+		return nil, false
+	}
+
+	file, err := afs.Open(name)
+	if err != nil {
+		return nil, false
+	}
+
+	defer file.Close() //nolint:errcheck
+
+	man, err := builder.ReadManifest(file)
+	if err != nil || man.Size != bin.Size() || man.Platform == nil || len(man.Modules) == 0 {
+		return nil, false
+	}
+
+	if man.Platform.String() != builder.RuntimePlatform().String() {
+		return nil, false
+	}
+
+	return man, true
+}
+
+func writeManifest(cmd string, afs afero.Fs, man *builder.Manifest) (err error) {
+	file, err := afs.OpenFile(builder.ManifestFile(cmd), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644) //nolint:forbidigo
+	if err != nil {
+		return err
+	}
+
+	defer deferredClose(file, &err)
+
+	return man.Write(file)
+}
+
 func addOptional(ctx context.Context, res resolver.Resolver, deps, opt dependency.Dependencies) {
 	if len(opt) == 0 {
 		return
@@ -162,21 +248,21 @@ func build(
 		return err
 	}
 
-	fname := filepath.Join(opts.dirs.bin, "k6")
-	if runtime.GOOS == "windows" {
-		fname += ".exe"
-	}
+	fname := binaryFile(opts)
 
 	var file afero.File
 
-	file, err = afs.OpenFile(fname, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755) //nolint:forbidigo
+	file, err = afs.OpenFile(fname, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o755) //nolint:forbidigo
 	if err != nil {
 		return err
 	}
 
 	defer deferredClose(file, &err)
 
-	err = b.Build(ctx, nil, mods, file)
+	bctx, cancel := withBuildTimeout(ctx, opts)
+	defer cancel()
+
+	man, err := b.Build(bctx, nil, mods, file)
 	if err != nil {
 		file.Close()      //nolint:gosec,errcheck
 		afs.Remove(fname) //nolint:gosec,errcheck
@@ -184,7 +270,30 @@ func build(
 		return err
 	}
 
-	return file.Close()
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	man.Filter = opts.filter
+
+	return writeManifest(fname, afs, man)
+}
+
+func withBuildTimeout(ctx context.Context, opts *options) (context.Context, context.CancelFunc) {
+	if opts.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, opts.timeout)
+}
+
+func binaryFile(opts *options) string {
+	fname := filepath.Join(opts.dirs.bin, "k6")
+	if runtime.GOOS == "windows" {
+		fname += ".exe"
+	}
+
+	return fname
 }
 
 func exists(file string, afs afero.Fs) bool {
@@ -7,9 +7,13 @@ package cmd
 import (
 	"context"
 	"io"
+	"os"
 
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
 	"github.com/szkiba/k6x/internal/dependency"
 	"github.com/szkiba/k6x/internal/resolver"
+	"github.com/szkiba/k6x/internal/sbom"
 )
 
 func buildCommand(
@@ -29,7 +33,42 @@ func buildCommand(
 		return err
 	}
 
-	return prepare(ctx, "", deps, res, opts)
+	if err = prepare(ctx, "", deps, res, opts); err != nil {
+		return err
+	}
+
+	if len(opts.sbom) == 0 {
+		return nil
+	}
+
+	return writeSBOM(binaryFile(opts), opts.sbom, opts.dirs.fs)
+}
+
+func writeSBOM(cmd string, dest string, afs afero.Fs) (err error) {
+	logrus.Infof("generating SBOM (target: %s)", dest)
+
+	binary, err := afs.Open(cmd)
+	if err != nil {
+		return err
+	}
+
+	defer binary.Close() //nolint:errcheck
+
+	man, _ := readManifest(cmd, afs)
+
+	doc, err := sbom.Read(binary, man)
+	if err != nil {
+		return err
+	}
+
+	file, err := afs.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644) //nolint:forbidigo
+	if err != nil {
+		return err
+	}
+
+	defer deferredClose(file, &err)
+
+	return doc.Write(file)
 }
 
 const buildUsage = `Build custom k6 binary for a script.
@@ -44,6 +83,14 @@ Flags:
   --with dependency  additional dependency and version constraints
   --filter expr      jmespath syntax extension registry filter (default: [*])
   --builder list     comma separated list of builders (default: {{.builders}})
+  --cgo              enable cgo
+  --race             enable race detector
+  --tags list        comma separated list of go build tags
+  --ldflags flags    additional go linker flags
+  --trimpath         remove file system paths (always enabled)
+  --go-version expr  required go toolchain version constraints
+  --build-timeout d  maximum duration of the k6 build (default: no limit)
+  --sbom file        write CycloneDX SBOM of the k6 binary to file
   --no-color         disable colored output  
   -h, --help         display this help
 `
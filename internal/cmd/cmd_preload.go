@@ -6,7 +6,10 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"text/tabwriter"
 
 	"github.com/szkiba/k6x/internal/builder"
 	"github.com/szkiba/k6x/internal/dependency"
@@ -23,6 +26,47 @@ func preloadCommand(
 		return usage(out, preloadUsage, opts)
 	}
 
+	sets, err := collectPreloadSets(ctx, res, opts)
+	if err != nil {
+		return err
+	}
+
+	b, err := builder.New(ctx, opts.engines...)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withBuildTimeout(ctx, opts)
+	defer cancel()
+
+	report, err := builder.Preload(ctx, b, sets, opts.parallel, opts.outdir)
+	if report == nil {
+		return err
+	}
+
+	opts.spinner.Stop()
+
+	if perr := printPreloadReport(out, report, opts.json); perr != nil && err == nil {
+		err = perr
+	}
+
+	return err
+}
+
+func collectPreloadSets(
+	ctx context.Context,
+	res resolver.Resolver,
+	opts *options,
+) ([]*builder.PreloadSet, error) {
+	if len(opts.manifest) != 0 {
+		manifest, err := readPreloadManifest(opts.manifest, opts.dirs.fs)
+		if err != nil {
+			return nil, err
+		}
+
+		return preloadSets(ctx, res, manifest, opts.platforms)
+	}
+
 	var mods dependency.Modules
 	var err error
 
@@ -35,15 +79,49 @@ func preloadCommand(
 	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	b, err := builder.New(ctx, opts.engines...)
-	if err != nil {
-		return err
+	return []*builder.PreloadSet{{Modules: mods, Platforms: opts.platforms}}, nil
+}
+
+func printPreloadReport(out io.Writer, report *builder.PreloadReport, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetEscapeHTML(false)
+
+		return encoder.Encode(report)
+	}
+
+	tab := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tab, "SET\tPLATFORM\tSTATUS\tDURATION\tCACHE\tERROR")
+
+	for _, res := range report.Results {
+		status, cache := "ok", "-"
+
+		if !res.Success {
+			status = "failed"
+		}
+
+		if res.CacheHit != nil {
+			cache = "miss"
+			if *res.CacheHit {
+				cache = "hit"
+			}
+		}
+
+		set := res.Set
+		if len(set) == 0 {
+			set = "-"
+		}
+
+		fmt.Fprintf(tab, "%s\t%s\t%s\t%s\t%s\t%s\n", set, res.Platform, status, res.Duration, cache, res.Error)
 	}
 
-	return builder.Preload(ctx, b, mods, opts.platforms)
+	fmt.Fprintf(tab, "\ntotal: %d builds, %d failed, %s\n", len(report.Results), report.Failed(), report.Duration)
+
+	return tab.Flush()
 }
 
 const preloadUsage = `Preload the build cache with popular extensions.
@@ -57,5 +135,10 @@ Flags:
   --with dependency  dependency and version constraints (default: latest version of k6 and registered extensions)
   --filter expr      jmespath syntax extension registry filter (default: [*])
   --builder list     comma separated list of builders (default: {{.builders}})
+  --build-timeout d  maximum duration of the preload (default: no limit)
+  --parallel number  maximum number of concurrent service and docker builds (default: 2)
+  --manifest file    preload dependency sets listed in the YAML or JSON file
+  --output-dir dir   store the built k6 binaries in the directory
+  --json             print the report in JSON format
   -h, --help         display this help
 `
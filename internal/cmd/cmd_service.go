@@ -6,27 +6,22 @@ package cmd
 
 import (
 	"context"
-	"math"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"os"
-	"runtime"
+	"os/signal"
 	"runtime/debug"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
-	"github.com/szkiba/k6x/internal/builder"
 	"github.com/szkiba/k6x/internal/resolver"
 	"github.com/szkiba/k6x/internal/service"
 	"golang.org/x/net/netutil"
 )
 
-const (
-	readHeaderTimeout = 5 * time.Second
-	readTimeout       = 5 * time.Second
-	writeTimeout      = 100 * time.Second
-)
-
 func serviceCommand(
 	ctx context.Context,
 	res resolver.Resolver,
@@ -39,17 +34,52 @@ func serviceCommand(
 
 	opts.spinner.Disable()
 
-	b, err := builder.New(ctx, opts.engines...)
+	// SIGTERM (e.g. from the container runtime) starts the graceful shutdown too
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM)
+	defer stop()
+
+	if opts.maxConns < 1 {
+		return fmt.Errorf("%w: %d", errInvalidMaxConns, opts.maxConns)
+	}
+
+	cfg, upstream, err := opts.serviceConfig()
+	if err != nil {
+		return err
+	}
+
+	b, err := opts.serviceBuilder(ctx, upstream)
+	if err != nil {
+		return err
+	}
+
+	auditLog, err := opts.openAuditLog(out)
+	if err != nil {
+		return err
+	}
+
+	if auditLog != nil {
+		defer auditLog.Close() //nolint:errcheck
+
+		cfg.AuditLog = auditLog
+	}
+
+	handler, err := service.New(res, b, cfg)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := opts.serviceTLSConfig(len(cfg.Clients) != 0)
 	if err != nil {
 		return err
 	}
 
 	server := &http.Server{
 		Addr:              opts.addr,
-		Handler:           recovery(service.New(res, b)),
-		ReadHeaderTimeout: readHeaderTimeout,
-		ReadTimeout:       readTimeout,
-		WriteTimeout:      writeTimeout,
+		Handler:           recovery(handler),
+		ReadHeaderTimeout: opts.headerTimeout,
+		ReadTimeout:       opts.readTimeout,
+		WriteTimeout:      opts.writeTimeout,
+		TLSConfig:         tlsConfig,
 	}
 
 	l, err := net.Listen("tcp", opts.addr)
@@ -59,9 +89,49 @@ func serviceCommand(
 
 	defer l.Close() //nolint:errcheck
 
-	limit := int(math.Max(2, float64(runtime.NumCPU())/4.0))
+	drained := make(chan struct{})
+
+	go func() {
+		defer close(drained)
+
+		<-ctx.Done()
+
+		shutdown(server, handler, opts.drainTimeout)
+	}()
+
+	if tlsConfig != nil {
+		err = server.ServeTLS(netutil.LimitListener(l, opts.maxConns), opts.tlsCert, opts.tlsKey)
+	} else {
+		err = server.Serve(netutil.LimitListener(l, opts.maxConns))
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		<-drained
+
+		return nil
+	}
+
+	return err
+}
+
+// shutdown stops accepting new requests, then waits for the in-flight requests and builds
+// (including the build jobs) to finish, at most for the drain timeout.
+func shutdown(server *http.Server, handler http.Handler, timeout time.Duration) {
+	logrus.Info("shutting down, draining in-flight builds")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	return server.Serve(netutil.LimitListener(l, limit))
+	err := server.Shutdown(ctx)
+	if err == nil {
+		err = service.Drain(ctx, handler)
+	}
+
+	if err != nil {
+		logrus.WithError(err).Warn("drain error")
+
+		server.Close() //nolint:errcheck,gosec
+	}
 }
 
 func recovery(handler http.Handler) http.Handler {
@@ -85,9 +155,31 @@ Usage:
   {{.appname}} service [flags]
 
 Flags:
-  --addr address     listen address (default: 127.0.0.1:8787)
-  --filter expr      jmespath syntax extension registry filter (default: [*])
-  --builder list     comma separated list of builders (default: {{.builders}})
+  --addr address        listen address (default: 127.0.0.1:8787)
+  --filter expr         jmespath syntax extension registry filter (default: [*])
+  --builder list        comma separated list of builders (default: {{.builders}})
+  --store dir           store the built k6 binaries in the directory
+  --store-size size     size limit of the artifact store (default: 10GB)
+  --config file         service configuration file (YAML or JSON)
+  --tls-cert file       TLS certificate file (PEM)
+  --tls-key file        TLS private key file (PEM)
+  --tls-client-ca file  CA bundle for verifying TLS client certificates (PEM)
+  --signing-key file    Ed25519 private key for signing the k6 binaries (PEM)
+  --upstream list       comma separated list of upstream build service endpoints (proxy mode)
+  --allow-options list  build options allowed for the clients (default: tags)
+  --rate-limit rate     allowed requests per second per client (default: unlimited)
+  --rate-burst n        allowed request burst per client (default: rate limit)
+  --client-builds n     allowed concurrent builds per client (default: unlimited)
+  --audit-log dest      audit log file, or - for standard output (default: disabled)
+  --audit-rotate size   audit log file size before rotation (default: 100MB)
+  --max-conns n         allowed concurrent connections (default: CPU count / 4, at least 2)
+  --max-builds n        allowed concurrent builds of the service (default: unlimited)
+  --header-timeout dur  timeout for reading the request headers (default: 5s)
+  --read-timeout dur    timeout for reading the entire request (default: 5s)
+  --write-timeout dur   timeout for writing the response (default: 100s)
+  --drain-timeout dur   timeout for draining the in-flight builds on shutdown (default: 5m)
+  --max-age dur         cache max-age of the k6 binaries (default: 1h)
+  --max-age-stale dur   cache stale-while-revalidate and stale-if-error period (default: 10m)
 
   -h, --help      display this help
 `
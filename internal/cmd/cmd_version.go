@@ -48,6 +48,13 @@ var versionUsage = `Launcher Flags:
   --bin-dir path    cache folder for k6 binary (default: {{.bin}})
   --cache-dir path  set cache base directory
   --builder list    comma separated list of builders (default: {{.builders}})
+  --cgo             enable cgo
+  --race            enable race detector
+  --tags list       comma separated list of go build tags
+  --ldflags flags   additional go linker flags
+  --trimpath        remove file system paths (always enabled)
+  --go-version expr required go toolchain version constraints
+  --build-timeout d maximum duration of the k6 build (default: no limit)
   --clean           remove cached k6 binary
   --dry             do not run k6 command
 
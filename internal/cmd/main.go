@@ -23,18 +23,48 @@ import (
 	"github.com/szkiba/k6x/internal/resolver"
 )
 
-const exitErr = 116
+const (
+	exitErr         = 116
+	exitInterrupted = 1
+)
 
 // Main is the main entry point.
 func Main(ctx context.Context, args []string, stdin, stdout, stderr *os.File, afs afero.Fs) int {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	// the default behavior is restored after the first interrupt,
+	// so a second interrupt terminates the process even if the cleanup hangs
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	code, err := main(ctx, args, stdin, stdout, stderr, afs)
-	if err != nil {
-		logrus.Error(err)
+	if err == nil {
+		return code
 	}
 
+	if interrupted(ctx) {
+		logrus.Warn("interrupted")
+
+		return exitInterrupted
+	}
+
+	logrus.Error(err)
+
 	return code
 }
 
+// interrupted reports whether the command failed because it was interrupted. The context is checked
+// instead of the error, because a killed build subprocess (xk6, docker) returns an exec error.
+func interrupted(ctx context.Context) bool {
+	return ctx.Err() != nil
+}
+
+// newResolver creates the extension resolver, it can be replaced in tests.
+var newResolver = resolver.New //nolint:gochecknoglobals
+
 func main(
 	ctx context.Context,
 	args []string,
@@ -49,19 +79,15 @@ func main(
 	defer opts.spinner.Stop()
 
 	ctx = builder.WithReplacements(ctx, opts.reps)
+	ctx = builder.WithOptions(ctx, opts.bopts)
 
-	initLogger(opts)
+	if opts.goVer != nil {
+		ctx = builder.WithGoVersion(ctx, opts.goVer)
+	}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() {
-		for range c {
-			opts.spinner.Stop()
-			os.Exit(1)
-		}
-	}()
+	initLogger(opts)
 
-	res, err := resolver.New(opts.dirs.http, opts.filter)
+	res, err := newResolver(opts.dirs.http, opts.filter)
 	if err != nil {
 		return exitErr, err
 	}
@@ -91,7 +117,12 @@ func main(
 	}
 
 	if opts.preload() {
-		return 0, preloadCommand(ctx, res, opts, stdout)
+		err = preloadCommand(ctx, res, opts, stdout)
+		if err == nil {
+			return 0, nil
+		}
+
+		return exitErr, err
 	}
 
 	if opts.version() {
@@ -155,6 +186,13 @@ Launcher Flags:
   --with dependency  additional dependency and version constraints
   --filter expr      jmespath syntax extension registry filter (default: [*])
   --builder list     comma separated list of builders (default: {{.builders}})
+  --cgo              enable cgo
+  --race             enable race detector
+  --tags list        comma separated list of go build tags
+  --ldflags flags    additional go linker flags
+  --trimpath         remove file system paths (always enabled)
+  --go-version expr  required go toolchain version constraints
+  --build-timeout d  maximum duration of the k6 build (default: no limit)
   --clean            remove cached k6 binary
   --dry              do not run k6 command
 `
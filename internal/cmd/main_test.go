@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/k6x/internal/dependency"
+	"github.com/szkiba/k6x/internal/resolver"
+)
+
+type testResolver struct{}
+
+func (testResolver) Resolve(_ context.Context, deps dependency.Dependencies) (dependency.Modules, error) {
+	mods := make(dependency.Modules, len(deps))
+
+	for name := range deps {
+		mod, err := dependency.NewModule(name, "v0.46.0", "go.k6.io/k6")
+		if err != nil {
+			return nil, err
+		}
+
+		mods[name] = mod
+	}
+
+	return mods, nil
+}
+
+func (testResolver) Starred(_ context.Context, _ int) (dependency.Modules, error) {
+	return dependency.Modules{}, nil
+}
+
+// slowService is a build service, which starts sending the k6 binary and never finishes it.
+func slowService(started chan<- struct{}) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/info" || strings.HasPrefix(req.URL.Path, "/jobs") {
+			http.NotFound(res, req)
+
+			return
+		}
+
+		res.Header().Set("Content-Length", strconv.Itoa(1<<20))
+		res.WriteHeader(http.StatusOK)
+		_, _ = res.Write(make([]byte, 1<<10))
+		res.(http.Flusher).Flush()
+
+		close(started)
+
+		<-req.Context().Done()
+	})
+}
+
+func TestMainInterrupted(t *testing.T) { //nolint:paralleltest
+	started := make(chan struct{})
+
+	srv := httptest.NewServer(slowService(started))
+	defer srv.Close()
+
+	tmp, dir := t.TempDir(), t.TempDir()
+
+	t.Setenv("TMPDIR", tmp)
+	t.Setenv("K6X_BUILDER_SERVICE", srv.URL)
+
+	newResolver = func(string, string) (resolver.Resolver, error) { return testResolver{}, nil }
+	defer func() { newResolver = resolver.New }()
+
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	assert.NoError(t, err)
+
+	defer null.Close() //nolint:errcheck
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	args := []string{
+		"k6x", "build", "--builder", "service",
+		"--bin-dir", filepath.Join(dir, "bin"), "--cache-dir", filepath.Join(dir, "cache"),
+	}
+
+	code := make(chan int)
+
+	go func() {
+		code <- Main(ctx, args, null, null, null, afero.NewOsFs())
+	}()
+
+	<-started
+	cancel()
+
+	assert.Equal(t, exitInterrupted, <-code)
+
+	assert.NoFileExists(t, filepath.Join(dir, "bin", "k6"))
+	assert.NoFileExists(t, filepath.Join(dir, "bin", "k6.exe"))
+
+	downloads, err := filepath.Glob(filepath.Join(tmp, "k6x-*.download"))
+	assert.NoError(t, err)
+	assert.Empty(t, downloads)
+}
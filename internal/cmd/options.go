@@ -7,11 +7,16 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/adrg/xdg"
 	"github.com/briandowns/spinner"
 	"github.com/spf13/afero"
@@ -51,15 +56,48 @@ type options struct {
 	out     []string
 	with    dependency.Dependencies
 	reps    builder.Replacements
+	bopts   *builder.Options
+	goVer   *semver.Constraints
+	timeout time.Duration
 	addr    string
+	store   string
+	size    int64
+	config  string
+	sbom    string
 	args    []string
 	argv    []string
 	dirs    *directories
 	appname string
 	spinner *spinner.Spinner
 
+	tlsCert     string
+	tlsKey      string
+	tlsClientCA string
+	signingKey  string
+	upstream    []string
+	allowOpts   []string
+
+	rateLimit    float64
+	rateBurst    int
+	clientBuilds int
+
+	auditLog    string
+	auditRotate int64
+
+	headerTimeout time.Duration
+	readTimeout   time.Duration
+	writeTimeout  time.Duration
+	drainTimeout  time.Duration
+	maxConns      int
+	maxBuilds     int
+	maxAge        time.Duration
+	maxAgeStale   time.Duration
+
 	platforms []*builder.Platform
 	stars     int
+	parallel  int
+	manifest  string
+	outdir    string
 }
 
 func checkargs(args []string, appname string) error {
@@ -96,17 +134,38 @@ func cleanargv(argv []string) []string {
 
 		if arg == "--bin-dir" || arg == "--cache-dir" || arg == "--builder" ||
 			arg == "--with" || arg == "--replace" ||
-			arg == "--filter" {
+			arg == "--filter" || arg == "--tags" || arg == "--ldflags" ||
+			arg == "--go-version" || arg == "--build-timeout" {
 			i++
 			continue
 		}
 
+		if isBuildFlag(arg) {
+			continue
+		}
+
 		clean = append(clean, arg)
 	}
 
 	return clean
 }
 
+func isBuildFlag(arg string) bool {
+	name := arg
+	if idx := strings.IndexRune(arg, '='); idx >= 0 {
+		name = arg[:idx]
+	}
+
+	switch name {
+	case "--cgo", "--race", "--trimpath":
+		return true
+	case "--tags", "--ldflags", "--go-version", "--build-timeout":
+		return name != arg
+	default:
+		return false
+	}
+}
+
 func newFlagSet(opts *options) *pflag.FlagSet {
 	flag := pflag.NewFlagSet("root", pflag.ContinueOnError)
 
@@ -134,13 +193,40 @@ func newFlagSet(opts *options) *pflag.FlagSet {
 	flag.BoolVar(&opts.resolve, "resolve", false, "")
 	flag.BoolVar(&opts.json, "json", false, "")
 
+	// build command
+	flag.StringVar(&opts.sbom, "sbom", "", "")
+
 	// service command
 	flag.StringVar(&opts.addr, "addr", "127.0.0.1:8787", "")
+	flag.StringVar(&opts.store, "store", "", "")
+	flag.StringVar(&opts.config, "config", "", "")
+	flag.StringVar(&opts.tlsCert, "tls-cert", "", "")
+	flag.StringVar(&opts.tlsKey, "tls-key", "", "")
+	flag.StringVar(&opts.tlsClientCA, "tls-client-ca", "", "")
+	flag.StringVar(&opts.signingKey, "signing-key", "", "")
+	flag.StringSliceVar(&opts.upstream, "upstream", nil, "")
+	flag.StringSliceVar(&opts.allowOpts, "allow-options", nil, "")
+	flag.Float64Var(&opts.rateLimit, "rate-limit", 0, "")
+	flag.IntVar(&opts.rateBurst, "rate-burst", 0, "")
+	flag.IntVar(&opts.clientBuilds, "client-builds", 0, "")
+	flag.StringVar(&opts.auditLog, "audit-log", "", "")
+	flag.DurationVar(&opts.headerTimeout, "header-timeout", defaultHeaderTimeout, "")
+	flag.DurationVar(&opts.readTimeout, "read-timeout", defaultReadTimeout, "")
+	flag.DurationVar(&opts.writeTimeout, "write-timeout", defaultWriteTimeout, "")
+	flag.DurationVar(&opts.drainTimeout, "drain-timeout", defaultDrainTimeout, "")
+	flag.IntVar(&opts.maxConns, "max-conns", defaultMaxConns(), "")
+	flag.IntVar(&opts.maxBuilds, "max-builds", 0, "")
+	flag.DurationVar(&opts.maxAge, "max-age", defaultMaxAge, "")
+	flag.DurationVar(&opts.maxAgeStale, "max-age-stale", defaultMaxAgeStale, "")
 
 	// preload command
 	flag.IntVar(&opts.stars, "stars", defaultStars, "")
+	flag.IntVar(&opts.parallel, "parallel", defaultParallel, "")
+	flag.StringVar(&opts.manifest, "manifest", "", "")
+	flag.StringVar(&opts.outdir, "output-dir", "", "")
 
 	// k6 commands
+	flag.DurationVar(&opts.timeout, "build-timeout", 0, "")
 	flag.BoolVar(&opts.clean, "clean", false, "")
 	flag.BoolVar(&opts.dry, "dry", false, "")
 
@@ -265,6 +351,17 @@ func getopts(argv []string, afs afero.Fs) (*options, error) {
 	with := flag.StringArray("with", []string{}, "")
 	replace := flag.StringArray("replace", []string{}, "")
 
+	opts.bopts = new(builder.Options)
+
+	flag.BoolVar(&opts.bopts.Cgo, "cgo", false, "")
+	flag.BoolVar(&opts.bopts.Race, "race", false, "")
+	flag.StringSliceVar(&opts.bopts.Tags, "tags", []string{}, "")
+	flag.StringVar(&opts.bopts.Ldflags, "ldflags", "", "")
+	trimpath := flag.Bool("trimpath", true, "")
+	storeSize := flag.String("store-size", defaultStoreSize, "")
+	auditRotate := flag.String("audit-rotate", defaultAuditRotate, "")
+	goVersion := flag.String("go-version", os.Getenv(strings.ToUpper(opts.appname)+"_GO_VERSION"), "") //nolint:forbidigo
+
 	if err = flag.Parse(opts.args); err != nil {
 		return nil, err
 	}
@@ -292,6 +389,27 @@ func getopts(argv []string, afs afero.Fs) (*options, error) {
 		return nil, err
 	}
 
+	if opts.size, err = parseSize(*storeSize); err != nil {
+		return nil, err
+	}
+
+	if opts.auditRotate, err = parseSize(*auditRotate); err != nil {
+		return nil, err
+	}
+
+	opts.bopts.NoTrimpath = !*trimpath
+	sort.Strings(opts.bopts.Tags)
+
+	if err = opts.bopts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(*goVersion) != 0 {
+		if opts.goVer, err = semver.NewConstraint(*goVersion); err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidGoVersion, err.Error())
+		}
+	}
+
 	if len(opts.reps) > 0 {
 		opts.engines = []builder.Engine{builder.Native}
 		opts.clean = true
@@ -444,6 +562,9 @@ var (
 	errStdinNotSupported = errors.New("standard input is not supported")
 	errInvalidWith       = errors.New("invalid with flag value")
 	errInvalidReplace    = errors.New("invalid replace flag value")
+	errInvalidGoVersion  = errors.New("invalid go-version flag value")
+	errInvalidSize       = errors.New("invalid size flag value")
+	errInvalidMaxConns   = errors.New("invalid max-conns flag value")
 
 	k6NoArgOpts = []string{ //nolint:gochecknoglobals
 		"no-usage-report",
@@ -459,6 +580,31 @@ var (
 	}
 )
 
+// parseSize parses a size in bytes with an optional KB, MB, GB or TB suffix (powers of 1024).
+func parseSize(str string) (int64, error) {
+	str = strings.ToUpper(strings.TrimSpace(str))
+
+	multiplier := int64(1)
+
+	for i, unit := range []string{"KB", "MB", "GB", "TB"} {
+		if strings.HasSuffix(str, unit) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, unit))
+			multiplier <<= 10 * (i + 1)
+
+			break
+		}
+	}
+
+	str = strings.TrimSuffix(str, "B")
+
+	num, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || num < 0 {
+		return 0, fmt.Errorf("%w: %s", errInvalidSize, str)
+	}
+
+	return num * multiplier, nil
+}
+
 func defaultBuilders() string {
 	var all strings.Builder
 
@@ -487,4 +633,22 @@ func defaultPlatforms() string {
 	return all.String()
 }
 
-const defaultStars = 5
+const (
+	defaultStars    = 5
+	defaultParallel = 2
+
+	defaultStoreSize   = "10GB"
+	defaultAuditRotate = "100MB"
+
+	defaultHeaderTimeout = 5 * time.Second
+	defaultReadTimeout   = 5 * time.Second
+	defaultWriteTimeout  = 100 * time.Second
+	defaultDrainTimeout  = 5 * time.Minute
+	defaultMaxAge        = time.Hour
+	defaultMaxAgeStale   = 10 * time.Minute
+)
+
+// defaultMaxConns returns the default limit of the concurrent service connections, depending on the CPU count.
+func defaultMaxConns() int {
+	return int(math.Max(2, float64(runtime.NumCPU())/4.0))
+}
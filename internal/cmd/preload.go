@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/afero"
+	"github.com/szkiba/k6x/internal/builder"
+	"github.com/szkiba/k6x/internal/resolver"
+	"gopkg.in/yaml.v3"
+)
+
+var errInvalidPreloadManifest = errors.New("invalid preload manifest")
+
+// preloadManifest describes named dependency sets to preload. JSON is also accepted as YAML.
+type preloadManifest struct {
+	Platforms []string `yaml:"platforms"`
+	Sets      []struct {
+		Name      string   `yaml:"name"`
+		With      []string `yaml:"with"`
+		Platforms []string `yaml:"platforms"`
+	} `yaml:"sets"`
+}
+
+func readPreloadManifest(filename string, afs afero.Fs) (*preloadManifest, error) {
+	src, err := afero.ReadFile(afs, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := new(preloadManifest)
+
+	if err := yaml.Unmarshal(src, manifest); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidPreloadManifest, err.Error())
+	}
+
+	if len(manifest.Sets) == 0 {
+		return nil, fmt.Errorf("%w: no sets", errInvalidPreloadManifest)
+	}
+
+	return manifest, nil
+}
+
+func preloadSets(
+	ctx context.Context,
+	res resolver.Resolver,
+	manifest *preloadManifest,
+	defaultPlatforms []*builder.Platform,
+) ([]*builder.PreloadSet, error) {
+	var err error
+
+	if len(manifest.Platforms) != 0 {
+		if defaultPlatforms, err = parsePlatforms(manifest.Platforms); err != nil {
+			return nil, err
+		}
+	}
+
+	sets := make([]*builder.PreloadSet, 0, len(manifest.Sets))
+	names := make(map[string]struct{}, len(manifest.Sets))
+
+	for idx, item := range manifest.Sets {
+		set := &builder.PreloadSet{Name: item.Name, Platforms: defaultPlatforms}
+
+		if len(set.Name) == 0 {
+			set.Name = fmt.Sprintf("set-%d", idx+1)
+		}
+
+		if _, dup := names[set.Name]; dup {
+			return nil, fmt.Errorf("%w: duplicate set name %s", errInvalidPreloadManifest, set.Name)
+		}
+
+		names[set.Name] = struct{}{}
+
+		if len(item.Platforms) != 0 {
+			if set.Platforms, err = parsePlatforms(item.Platforms); err != nil {
+				return nil, err
+			}
+		}
+
+		deps, err := parseWith(item.With)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", errInvalidPreloadManifest, set.Name, err.Error())
+		}
+
+		ensureK6(deps)
+
+		if set.Modules, err = res.Resolve(ctx, deps); err != nil {
+			return nil, fmt.Errorf("%s: %w", set.Name, err)
+		}
+
+		sets = append(sets, set)
+	}
+
+	return sets, nil
+}
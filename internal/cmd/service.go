@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/szkiba/k6x/internal/builder"
+	"github.com/szkiba/k6x/internal/service"
+	"gopkg.in/yaml.v3"
+)
+
+const proxyStoreDir = "store"
+
+var (
+	errInvalidServiceConfig = errors.New("invalid service config")
+	errInvalidTLS           = errors.New("invalid TLS flag value")
+	errInvalidSigningKey    = errors.New("invalid signing key")
+)
+
+// serviceConfig is the YAML (or JSON) configuration file of the builder service.
+type serviceConfig struct {
+	Clients  []*service.Client      `yaml:"clients"`
+	Disabled bool                   `yaml:"disabled"`
+	Upstream *builder.ServiceConfig `yaml:"upstream"`
+}
+
+func readServiceConfig(filename string, afs afero.Fs) (*serviceConfig, error) {
+	src, err := afero.ReadFile(afs, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	config := new(serviceConfig)
+
+	if err := yaml.Unmarshal(src, config); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidServiceConfig, err.Error())
+	}
+
+	for idx, client := range config.Clients {
+		if len(client.ID) == 0 {
+			client.ID = fmt.Sprintf("client-%d", idx+1)
+		}
+
+		// secrets can be passed in environment variables
+		client.Token = os.ExpandEnv(client.Token) //nolint:forbidigo
+	}
+
+	if config.Upstream != nil {
+		config.Upstream.Token = os.ExpandEnv(config.Upstream.Token) //nolint:forbidigo
+	}
+
+	return config, nil
+}
+
+// serviceConfig returns the service settings and the upstream build service settings (nil if not in proxy mode).
+func (opts *options) serviceConfig() (*service.Config, *builder.ServiceConfig, error) {
+	cfg := &service.Config{
+		StoreDir:     opts.store,
+		StoreSize:    opts.size,
+		Version:      _version,
+		RateLimit:    opts.rateLimit,
+		RateBurst:    opts.rateBurst,
+		ClientBuilds: opts.clientBuilds,
+		MaxBuilds:    opts.maxBuilds,
+		MaxAge:       opts.maxAge,
+		MaxAgeStale:  opts.maxAgeStale,
+
+		AllowedOptions: opts.allowOpts,
+	}
+
+	if len(opts.signingKey) != 0 {
+		key, err := readSigningKey(opts.signingKey, opts.dirs.fs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		cfg.SigningKey = key
+	}
+
+	config := new(serviceConfig)
+
+	if len(opts.config) != 0 {
+		var err error
+
+		if config, err = readServiceConfig(opts.config, opts.dirs.fs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	cfg.Clients = config.Clients
+	cfg.Disabled = config.Disabled
+
+	upstream := config.Upstream
+
+	if len(opts.upstream) != 0 {
+		if upstream == nil {
+			upstream = new(builder.ServiceConfig)
+		}
+
+		upstream.Endpoints = opts.upstream
+	}
+
+	if upstream != nil && len(upstream.Endpoints) == 0 {
+		return nil, nil, fmt.Errorf("%w: missing upstream endpoints", errInvalidServiceConfig)
+	}
+
+	// the proxy caches the upstream k6 binaries locally, so it always needs an artifact store
+	if upstream != nil && len(cfg.StoreDir) == 0 {
+		cfg.StoreDir = filepath.Join(opts.dirs.base, proxyStoreDir)
+
+		logrus.Infof("proxy mode, using artifact store %s", cfg.StoreDir)
+	}
+
+	return cfg, upstream, nil
+}
+
+// serviceBuilder returns the builder of the service: the upstream build service in proxy mode,
+// otherwise the first usable builder engine.
+func (opts *options) serviceBuilder(ctx context.Context, upstream *builder.ServiceConfig) (builder.Builder, error) {
+	if upstream == nil {
+		return builder.New(ctx, opts.engines...)
+	}
+
+	logrus.Infof("proxy mode, upstream: %s", strings.Join(upstream.Endpoints, ","))
+
+	return builder.NewServiceBuilder(ctx, upstream)
+}
+
+// readSigningKey reads a PKCS #8 encoded Ed25519 private key from a PEM file.
+func readSigningKey(filename string, afs afero.Fs) (ed25519.PrivateKey, error) {
+	src, err := afero.ReadFile(afs, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(src)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data in %s", errInvalidSigningKey, filename)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidSigningKey, err.Error())
+	}
+
+	signingKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: not an Ed25519 key", errInvalidSigningKey)
+	}
+
+	return signingKey, nil
+}
+
+// serviceTLSConfig returns the TLS config of the service, or nil if TLS is not enabled.
+// If a client CA is specified, client certificates are required, unless authorized clients are configured
+// (in this case clients can also authenticate with bearer tokens).
+func (opts *options) serviceTLSConfig(clients bool) (*tls.Config, error) {
+	if len(opts.tlsCert) == 0 && len(opts.tlsKey) == 0 {
+		if len(opts.tlsClientCA) != 0 {
+			return nil, fmt.Errorf("%w: client CA requires certificate and key", errInvalidTLS)
+		}
+
+		return nil, nil //nolint:nilnil
+	}
+
+	if len(opts.tlsCert) == 0 || len(opts.tlsKey) == 0 {
+		return nil, fmt.Errorf("%w: both certificate and key are required", errInvalidTLS)
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(opts.tlsClientCA) == 0 {
+		return config, nil
+	}
+
+	src, err := afero.ReadFile(opts.dirs.fs, opts.tlsClientCA)
+	if err != nil {
+		return nil, err
+	}
+
+	config.ClientCAs = x509.NewCertPool()
+
+	if !config.ClientCAs.AppendCertsFromPEM(src) {
+		return nil, fmt.Errorf("%w: no certificates in %s", errInvalidTLS, opts.tlsClientCA)
+	}
+
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if clients {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
@@ -161,6 +161,40 @@ func (mods Modules) MarshalJSON() ([]byte, error) {
 	return json.Marshal(dict)
 }
 
+func (mods *Modules) UnmarshalJSON(data []byte) error {
+	dict := make(map[string]string)
+
+	if err := json.Unmarshal(data, &dict); err != nil {
+		return err
+	}
+
+	if *mods == nil {
+		*mods = make(Modules, len(dict))
+	}
+
+	for name, loc := range dict {
+		path, tag := loc, latestTag
+
+		if idx := strings.LastIndex(loc, "@"); idx >= 0 {
+			path, tag = loc[:idx], loc[idx+1:]
+		}
+
+		version := ""
+		if tag != latestTag {
+			version = tag
+		}
+
+		mod, err := NewModule(name, version, path)
+		if err != nil {
+			return err
+		}
+
+		(*mods)[name] = mod
+	}
+
+	return nil
+}
+
 func (mods Modules) ToArtifacts() Artifacts {
 	arts := make(Artifacts, len(mods))
 
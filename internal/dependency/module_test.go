@@ -0,0 +1,38 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package dependency_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/k6x/internal/dependency"
+)
+
+func TestModules_UnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	k6, err := dependency.NewModule("k6", "v0.46.0", "")
+	assert.NoError(t, err)
+
+	faker, err := dependency.NewModule("k6/x/faker", "v0.2.2", "github.com/szkiba/xk6-faker")
+	assert.NoError(t, err)
+
+	top, err := dependency.NewModule("top", "", "github.com/szkiba/xk6-top")
+	assert.NoError(t, err)
+
+	mods := dependency.Modules{k6.Name: k6, faker.Name: faker, top.Name: top}
+
+	data, err := json.Marshal(mods)
+	assert.NoError(t, err)
+
+	var decoded dependency.Modules
+
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, mods.String(), decoded.String())
+
+	assert.Error(t, json.Unmarshal([]byte(`{"k6":"@vfoo"}`), &decoded))
+}
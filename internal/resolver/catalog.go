@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-github/v55/github"
+	"github.com/sirupsen/logrus"
+)
+
+// CatalogEntry describes an extension (or k6 itself) which can be used as dependency.
+type CatalogEntry struct {
+	Name        string   `json:"name"`
+	Modules     []string `json:"modules"`
+	Path        string   `json:"path"`
+	Description string   `json:"description,omitempty"`
+	Type        []string `json:"type,omitempty"`
+	Versions    []string `json:"versions"`
+}
+
+// Catalog returns k6 and the extensions of the (filtered) extension registry, with their resolvable versions.
+func Catalog(ctx context.Context, res Resolver) ([]*CatalogEntry, error) {
+	gh, ok := res.(*ghResolver)
+	if !ok {
+		return nil, fmt.Errorf("%w: catalog is not supported", ErrResolver)
+	}
+
+	reg, err := gh.getRegistry(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := gh.listVersions(ctx, "grafana", "k6")
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := []*CatalogEntry{{
+		Name:        k6,
+		Modules:     []string{k6},
+		Path:        "go.k6.io/k6",
+		Description: "A modern load testing tool, using Go and JavaScript",
+		Versions:    versions,
+	}}
+
+	for i := range reg.Extensions {
+		regExt := &reg.Extensions[i]
+
+		names := regExt.names()
+		if len(names) == 0 {
+			continue
+		}
+
+		path, err := regExt.path()
+		if err != nil {
+			continue
+		}
+
+		parts := strings.SplitN(path, "/", 4)
+		if len(parts) < 3 {
+			continue
+		}
+
+		versions, err := gh.listVersions(ctx, parts[1], parts[2])
+		if err != nil {
+			logrus.WithError(err).WithField("extension", regExt.Name).Warn("unable to list versions")
+
+			versions = []string{}
+		}
+
+		catalog = append(catalog, &CatalogEntry{
+			Name:        regExt.Name,
+			Modules:     names,
+			Path:        path,
+			Description: regExt.Description,
+			Type:        regExt.Type,
+			Versions:    versions,
+		})
+	}
+
+	sort.SliceStable(catalog[1:], func(i, j int) bool {
+		return catalog[i+1].Name < catalog[j+1].Name
+	})
+
+	return catalog, nil
+}
+
+// listVersions returns the semantic version tags of the repository, in descending order.
+func (res *ghResolver) listVersions(ctx context.Context, owner, repo string) ([]string, error) {
+	tags, _, err := res.client.Repositories.ListTags(ctx, owner, repo, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, err
+	}
+
+	vers := make([]*semver.Version, 0, len(tags))
+
+	for _, tag := range tags {
+		name := tag.GetName()
+		if len(name) == 0 || name[0] != 'v' {
+			continue
+		}
+
+		ver, err := semver.NewVersion(name)
+		if err != nil {
+			continue
+		}
+
+		vers = append(vers, ver)
+	}
+
+	sort.Sort(sort.Reverse(semver.Collection(vers)))
+
+	versions := make([]string, 0, len(vers))
+
+	for _, ver := range vers {
+		versions = append(versions, ver.Original())
+	}
+
+	return versions, nil
+}
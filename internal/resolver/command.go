@@ -62,11 +62,11 @@ func (res *commandResolver) resolveFromOutput(
 	return mods.Filter(deps), nil
 }
 
-func CommandDependencies(
+func CommandModules(
 	ctx context.Context,
 	cmd string,
 	args ...string,
-) (dependency.Dependencies, error) {
+) (dependency.Modules, error) {
 	out, err := exec.CommandContext(ctx, cmd, args...).Output()
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrResolver, err.Error())
@@ -77,6 +77,19 @@ func CommandDependencies(
 		return nil, fmt.Errorf("%w: %s", ErrResolver, err.Error())
 	}
 
+	return mods, nil
+}
+
+func CommandDependencies(
+	ctx context.Context,
+	cmd string,
+	args ...string,
+) (dependency.Dependencies, error) {
+	mods, err := CommandModules(ctx, cmd, args...)
+	if err != nil {
+		return nil, err
+	}
+
 	deps := make(dependency.Dependencies)
 
 	for name := range mods {
@@ -21,8 +21,9 @@ import (
 )
 
 type ghResolver struct {
-	client *github.Client
-	filter *jmespath.JMESPath
+	client   *github.Client
+	filter   *jmespath.JMESPath
+	restrict *jmespath.JMESPath
 }
 
 func New(cachedir string, filter string) (Resolver, error) {
@@ -46,6 +47,42 @@ func New(cachedir string, filter string) (Resolver, error) {
 	return res, nil
 }
 
+// Restrict returns a resolver sharing the registry client of res,
+// with an additional jmespath extension registry filter applied after the filter of res.
+// An error is returned if res doesn't support filtering, so the restriction can't fail open.
+func Restrict(res Resolver, filter string) (Resolver, error) {
+	if len(filter) == 0 {
+		return res, nil
+	}
+
+	gh, ok := res.(*ghResolver)
+	if !ok {
+		return nil, fmt.Errorf("%w: extension registry filter is not supported by %T", ErrResolver, res)
+	}
+
+	query, err := jmespath.Compile(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ghResolver{client: gh.client, filter: gh.filter, restrict: query}, nil
+}
+
+// Check returns an error if any of the dependencies is missing from the extension registry of res.
+// Unlike Resolve, the versions are not resolved.
+func Check(ctx context.Context, res Resolver, deps dependency.Dependencies) error {
+	gh, ok := res.(*ghResolver)
+	if !ok {
+		_, err := res.Resolve(ctx, deps)
+
+		return err
+	}
+
+	_, err := gh.resolveModules(ctx, deps)
+
+	return err
+}
+
 func (res *ghResolver) Resolve(
 	ctx context.Context,
 	deps dependency.Dependencies,
@@ -81,7 +118,12 @@ func (res *ghResolver) getRegistry(ctx context.Context) (*extensionRegistry, err
 		return nil, err
 	}
 
-	reg, err := parseExtensionRegistry([]byte(str), res.filter)
+	src, err := applyFilter([]byte(str), res.filter)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := parseExtensionRegistry(src, res.restrict)
 	if err != nil {
 		return nil, err
 	}
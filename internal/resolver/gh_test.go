@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package resolver_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/k6x/internal/dependency"
+	"github.com/szkiba/k6x/internal/resolver"
+)
+
+// staticResolver resolves every dependency, it doesn't support extension registry filters.
+type staticResolver struct{}
+
+func (staticResolver) Resolve(_ context.Context, deps dependency.Dependencies) (dependency.Modules, error) {
+	mods := make(dependency.Modules, len(deps))
+
+	for name := range deps {
+		mod, err := dependency.NewModule(name, "v0.46.0", "example.com/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		mods[name] = mod
+	}
+
+	return mods, nil
+}
+
+func (staticResolver) Starred(_ context.Context, _ int) (dependency.Modules, error) {
+	return dependency.Modules{}, nil
+}
+
+func TestRestrict(t *testing.T) {
+	t.Parallel()
+
+	gh, err := resolver.New(t.TempDir(), "")
+	assert.NoError(t, err)
+
+	res, err := resolver.Restrict(gh, "[?name=='k6']")
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+	assert.NotSame(t, gh, res)
+
+	res, err = resolver.Restrict(gh, "")
+	assert.NoError(t, err)
+	assert.Same(t, gh, res)
+
+	_, err = resolver.Restrict(gh, "[?")
+	assert.Error(t, err)
+}
+
+func TestRestrictUnsupported(t *testing.T) {
+	t.Parallel()
+
+	res, err := resolver.Restrict(staticResolver{}, "[?name=='k6']")
+	assert.ErrorIs(t, err, resolver.ErrResolver)
+	assert.Nil(t, res)
+
+	// without filter there is nothing to restrict
+	res, err = resolver.Restrict(staticResolver{}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, staticResolver{}, res)
+}
@@ -19,9 +19,10 @@ type extensionRegistry struct {
 }
 
 type registeredExtension struct {
-	Name string   `json:"name,omitempty"`
-	URL  string   `json:"url,omitempty"`
-	Type []string `json:"type,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Type        []string `json:"type,omitempty"`
 }
 
 func applyFilter(src []byte, filter *jmespath.JMESPath) ([]byte, error) {
@@ -74,31 +75,59 @@ func (reg *extensionRegistry) toModules() dependency.Modules {
 	}
 
 	for _, regExt := range reg.Extensions {
-		loc, err := url.Parse(regExt.URL)
+		path, err := regExt.path()
 		if err != nil {
 			continue
 		}
 
-		path := loc.Host + loc.Path
+		for _, name := range regExt.names() {
+			add(path, name)
+		}
+	}
 
-		for _, typ := range regExt.Type {
-			if typ == "Output" {
-				add(path, regExt.Name)
-				add(path, strings.TrimPrefix(regExt.Name, "xk6-output-"))
-				add(path, strings.TrimPrefix(regExt.Name, "xk6-"))
-			}
+	return mods
+}
 
-			if typ == "JavaScript" {
-				add(path, "k6/x/"+strings.TrimPrefix(regExt.Name, "xk6-"))
+// path returns the go module path of the extension.
+func (regExt *registeredExtension) path() (string, error) {
+	loc, err := url.Parse(regExt.URL)
+	if err != nil {
+		return "", err
+	}
 
-				if idx := strings.LastIndex(regExt.Name, "-"); idx >= 0 && idx < len(regExt.Name) {
-					add(path, "k6/x/"+regExt.Name[idx+1:])
-				}
+	return loc.Host + loc.Path, nil
+}
+
+// names returns the dependency names by which the extension can be referenced.
+func (regExt *registeredExtension) names() []string {
+	var names []string
+
+	seen := make(map[string]struct{})
+
+	add := func(name string) {
+		if _, found := seen[name]; !found {
+			seen[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+
+	for _, typ := range regExt.Type {
+		if typ == "Output" {
+			add(regExt.Name)
+			add(strings.TrimPrefix(regExt.Name, "xk6-output-"))
+			add(strings.TrimPrefix(regExt.Name, "xk6-"))
+		}
+
+		if typ == "JavaScript" {
+			add("k6/x/" + strings.TrimPrefix(regExt.Name, "xk6-"))
+
+			if idx := strings.LastIndex(regExt.Name, "-"); idx >= 0 && idx < len(regExt.Name) {
+				add("k6/x/" + regExt.Name[idx+1:])
 			}
 		}
 	}
 
-	return mods
+	return names
 }
 
 func (reg *extensionRegistry) toUniqueModules() dependency.Modules {
@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package sbom contains software bill of materials generation for k6 binaries.
+//
+//nolint:revive
+package sbom
+
+import (
+	"crypto/rand"
+	"debug/buildinfo"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/szkiba/k6x/internal/builder"
+)
+
+const (
+	ContentType = "application/vnd.cyclonedx+json"
+
+	bomFormat   = "CycloneDX"
+	specVersion = "1.5"
+
+	k6Module = "go.k6.io/k6"
+
+	dependenciesFlat    = "direct dependencies only"
+	aggregateIncomplete = "incomplete"
+)
+
+type Document struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber,omitempty"`
+	Version      int            `json:"version"`
+	Metadata     *Metadata      `json:"metadata"`
+	Components   []*Component   `json:"components"`
+	Dependencies []*Dependency  `json:"dependencies"`
+	Compositions []*Composition `json:"compositions,omitempty"`
+}
+
+type Metadata struct {
+	Timestamp  string      `json:"timestamp"`
+	Tools      []*Tool     `json:"tools,omitempty"`
+	Component  *Component  `json:"component"`
+	Properties []*Property `json:"properties,omitempty"`
+}
+
+type Tool struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type Component struct {
+	BOMRef     string      `json:"bom-ref"`
+	Type       string      `json:"type"`
+	Name       string      `json:"name"`
+	Version    string      `json:"version,omitempty"`
+	PURL       string      `json:"purl,omitempty"`
+	Hashes     []*Hash     `json:"hashes,omitempty"`
+	Properties []*Property `json:"properties,omitempty"`
+}
+
+type Hash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Dependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// Composition describes the completeness of the listed dependencies.
+type Composition struct {
+	Aggregate    string   `json:"aggregate"`
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+// Read generates SBOM from the build info embedded in a k6 binary.
+// The optional manifest is used to mark extension modules and the binary digest.
+func Read(binary io.ReaderAt, man *builder.Manifest) (*Document, error) {
+	info, err := buildinfo.Read(binary)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(info, man), nil
+}
+
+func New(info *debug.BuildInfo, man *builder.Manifest) *Document {
+	doc := new(Document)
+
+	doc.BOMFormat = bomFormat
+	doc.SpecVersion = specVersion
+	doc.SerialNumber = serialNumber()
+	doc.Version = 1
+
+	root := &Component{BOMRef: "k6", Type: "application", Name: "k6"}
+
+	root.Properties = append(root.Properties, &Property{Name: "go", Value: info.GoVersion})
+
+	for _, setting := range info.Settings {
+		root.Properties = append(root.Properties, &Property{Name: "go:" + setting.Key, Value: setting.Value})
+	}
+
+	extensions := make(map[string][]string)
+
+	if man != nil {
+		for _, mod := range man.Modules.Extensions() {
+			extensions[mod.Path] = append(extensions[mod.Path], mod.Name)
+		}
+
+		root.Hashes = append(root.Hashes, &Hash{Alg: "SHA-256", Content: man.SHA256})
+		root.Properties = append(root.Properties, &Property{Name: "k6x:engine", Value: man.Engine.String()})
+	}
+
+	deps := &Dependency{Ref: root.BOMRef}
+
+	for _, mod := range info.Deps {
+		comp := newComponent(mod)
+
+		if mod.Path == k6Module {
+			root.Version = mod.Version
+			root.PURL = purl(mod)
+		}
+
+		for _, name := range extensions[mod.Path] {
+			comp.Properties = append(comp.Properties, &Property{Name: "k6x:extension", Value: name})
+		}
+
+		doc.Components = append(doc.Components, comp)
+		deps.DependsOn = append(deps.DependsOn, comp.BOMRef)
+	}
+
+	sort.Slice(doc.Components, func(i, j int) bool {
+		return doc.Components[i].BOMRef < doc.Components[j].BOMRef
+	})
+
+	sort.Strings(deps.DependsOn)
+
+	doc.Metadata = &Metadata{
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Tools:     []*Tool{{Name: "k6x"}},
+		Component: root,
+		// the build info contains the build list only, so the modules are listed as direct dependencies of k6
+		Properties: []*Property{{Name: "k6x:dependencies", Value: dependenciesFlat}},
+	}
+
+	doc.Dependencies = []*Dependency{deps}
+	doc.Compositions = []*Composition{{Aggregate: aggregateIncomplete, Dependencies: []string{root.BOMRef}}}
+
+	return doc
+}
+
+func (doc *Document) Write(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(doc)
+}
+
+func newComponent(mod *debug.Module) *Component {
+	comp := new(Component)
+
+	comp.Type = "library"
+	comp.Name = mod.Path
+	comp.Version = mod.Version
+	comp.PURL = purl(mod)
+	comp.BOMRef = comp.PURL
+
+	if mod.Replace != nil {
+		comp.Properties = append(comp.Properties, &Property{Name: "go:replace", Value: purl(mod.Replace)})
+	}
+
+	return comp
+}
+
+func purl(mod *debug.Module) string {
+	if len(mod.Version) == 0 {
+		return "pkg:golang/" + mod.Path
+	}
+
+	return "pkg:golang/" + mod.Path + "@" + mod.Version
+}
+
+func serialNumber() string {
+	var uuid [16]byte
+
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return ""
+	}
+
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
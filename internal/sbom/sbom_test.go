@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package sbom_test
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/k6x/internal/builder"
+	"github.com/szkiba/k6x/internal/dependency"
+	"github.com/szkiba/k6x/internal/sbom"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	info := &debug.BuildInfo{
+		GoVersion: "go1.21.0",
+		Main:      debug.Module{Path: "k6"},
+		Deps: []*debug.Module{
+			{Path: "go.k6.io/k6", Version: "v0.46.0"},
+			{Path: "github.com/szkiba/xk6-faker", Version: "v0.2.2"},
+		},
+	}
+
+	faker, err := dependency.NewModule("k6/x/faker", "v0.2.2", "github.com/szkiba/xk6-faker")
+	assert.NoError(t, err)
+
+	man := &builder.Manifest{
+		Engine:  builder.Native,
+		Modules: dependency.Modules{faker.Name: faker},
+		SHA256:  "cafe",
+	}
+
+	doc := sbom.New(info, man)
+
+	assert.Equal(t, "CycloneDX", doc.BOMFormat)
+	assert.Equal(t, "v0.46.0", doc.Metadata.Component.Version)
+	assert.Len(t, doc.Components, 2)
+	assert.Equal(t, "pkg:golang/github.com/szkiba/xk6-faker@v0.2.2", doc.Components[0].PURL)
+	assert.Equal(t, "k6/x/faker", doc.Components[0].Properties[0].Value)
+	assert.Equal(t, "pkg:golang/go.k6.io/k6@v0.46.0", doc.Metadata.Component.PURL)
+	assert.Len(t, doc.Dependencies[0].DependsOn, 2)
+	assert.Equal(t, "direct dependencies only", doc.Metadata.Properties[0].Value)
+	assert.Equal(t, "incomplete", doc.Compositions[0].Aggregate)
+	assert.Equal(t, []string{"k6"}, doc.Compositions[0].Dependencies)
+}
@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// request outcomes of the audit log
+const (
+	auditSuccess  = "success"
+	auditRedirect = "redirect"
+	auditDenied   = "denied"
+	auditLimited  = "limited"
+	auditFailure  = "failure"
+)
+
+// auditRecord is a line of the audit log, describing a request.
+type auditRecord struct {
+	Time     time.Time `json:"time"`
+	Remote   string    `json:"remote"`
+	Client   string    `json:"client,omitempty"`
+	TokenID  string    `json:"tokenId,omitempty"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Params   string    `json:"params,omitempty"`
+	Action   string    `json:"action,omitempty"`
+	Status   int       `json:"status"`
+	Outcome  string    `json:"outcome"`
+	Duration float64   `json:"duration"`
+	Digest   string    `json:"digest,omitempty"`
+}
+
+// identify records the authenticated client of the request.
+func (rec *auditRecord) identify(client *Client, req *http.Request) {
+	if rec == nil {
+		return
+	}
+
+	rec.Client = client.ID
+
+	if token, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); found {
+		rec.TokenID = tokenID(token)
+	}
+}
+
+// act records the action performed for the request.
+func (rec *auditRecord) act(params *Params, action string) {
+	if rec == nil {
+		return
+	}
+
+	rec.Params = params.String()
+	rec.Action = action
+}
+
+// served records the digest of the k6 binary served for the request.
+func (rec *auditRecord) served(art *artifact) {
+	if rec == nil {
+		return
+	}
+
+	rec.Digest = hex.EncodeToString(art.digest)
+}
+
+// tokenID returns a fingerprint of the bearer token, which identifies the token without revealing it.
+func tokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// auditor writes the audit log records as JSON lines, independently of the log level.
+type auditor struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func newAuditor(out io.Writer) *auditor {
+	return &auditor{out: out}
+}
+
+func (a *auditor) write(rec *auditRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.out.Write(append(line, '\n')); err != nil {
+		logrus.WithError(err).Error("audit log error")
+	}
+}
+
+// middleware writes an audit log record for each request (except the health checks and metrics).
+func (a *auditor) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if publicPath(req.URL.Path) {
+			next.ServeHTTP(res, req)
+
+			return
+		}
+
+		rec := &auditRecord{
+			Time:   time.Now().UTC(),
+			Remote: remoteHost(req),
+			Method: req.Method,
+			Path:   requestString(req.URL),
+		}
+
+		recorder := &statusRecorder{ResponseWriter: res, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, req.WithContext(withAudit(req.Context(), rec)))
+
+		rec.Status = recorder.status
+		rec.Outcome = auditOutcome(recorder.status)
+		rec.Duration = time.Since(rec.Time).Seconds()
+
+		a.write(rec)
+	})
+}
+
+func auditOutcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return auditDenied
+	case status == http.StatusTooManyRequests:
+		return auditLimited
+	case status >= http.StatusBadRequest:
+		return auditFailure
+	case status >= http.StatusMultipleChoices:
+		return auditRedirect
+	default:
+		return auditSuccess
+	}
+}
+
+// statusRecorder records the response status.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// remoteHost returns the IP address of the client.
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+type auditKey struct{}
+
+func withAudit(ctx context.Context, rec *auditRecord) context.Context {
+	return context.WithValue(ctx, auditKey{}, rec)
+}
+
+// auditFromContext returns the audit record of the request, or nil if the audit log is disabled.
+func auditFromContext(ctx context.Context) *auditRecord {
+	if rec, ok := ctx.Value(auditKey{}).(*auditRecord); ok {
+		return rec
+	}
+
+	return nil
+}
+
+// logAction logs the action performed for params, and records it in the audit log.
+func logAction(ctx context.Context, log *logrus.Entry, params *Params, action string) {
+	log.WithField("action", action).Info()
+
+	auditFromContext(ctx).act(params, action)
+}
@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+
+	var buff bytes.Buffer
+
+	clients := []*Client{{ID: "ci", Token: "secret"}}
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{Clients: clients, AuditLog: &buff})
+	assert.NoError(t, err)
+
+	get := func(path, token string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if len(token) != 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	get("/linux/amd64/k6@v0.46.0", "secret")
+	get("/linux/amd64/k6@0.46.0", "secret")
+	get("/linux/amd64/k6@v0.46.0", "invalid")
+	get("/healthz", "")
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	assert.Len(t, lines, 3)
+
+	records := make([]*auditRecord, len(lines))
+
+	for idx, line := range lines {
+		records[idx] = new(auditRecord)
+		assert.NoError(t, json.Unmarshal([]byte(line), records[idx]))
+	}
+
+	assert.Equal(t, "ci", records[0].Client)
+	assert.Equal(t, tokenID("secret"), records[0].TokenID)
+	assert.Equal(t, "/linux/amd64/k6@v0.46.0", records[0].Params)
+	assert.Equal(t, "build", records[0].Action)
+	assert.Equal(t, auditSuccess, records[0].Outcome)
+	assert.Equal(t, http.StatusOK, records[0].Status)
+	assert.NotEmpty(t, records[0].Digest)
+
+	assert.Equal(t, "/linux/amd64/k6@0.46.0", records[1].Path)
+	assert.Equal(t, "redirect", records[1].Action)
+	assert.Equal(t, auditRedirect, records[1].Outcome)
+
+	assert.Empty(t, records[2].Client)
+	assert.Equal(t, auditDenied, records[2].Outcome)
+}
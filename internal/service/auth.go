@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/szkiba/k6x/internal/builder"
+	"github.com/szkiba/k6x/internal/resolver"
+)
+
+// Client is an authorized client of the service, identified by a bearer token
+// or by the common name of its TLS client certificate.
+type Client struct {
+	// ID identifies the client in the logs.
+	ID string `yaml:"id" json:"id"`
+	// Token is the bearer token of the client.
+	Token string `yaml:"token" json:"-"`
+	// Subject is the common name of the TLS client certificate of the client.
+	Subject string `yaml:"subject" json:"-"`
+	// Filter is a jmespath syntax extension registry filter, limiting the extensions allowed for the client.
+	Filter string `yaml:"filter" json:"-"`
+	// Platforms lists the platforms allowed for the client, all supported platforms are allowed if empty.
+	Platforms []string `yaml:"platforms" json:"-"`
+	// RateLimit overrides the allowed request rate of the client (requests per second).
+	RateLimit float64 `yaml:"rateLimit" json:"-"`
+	// RateBurst overrides the allowed request burst of the client.
+	RateBurst int `yaml:"rateBurst" json:"-"`
+	// MaxBuilds overrides the allowed number of concurrent builds of the client.
+	MaxBuilds int `yaml:"maxBuilds" json:"-"`
+
+	resolver  resolver.Resolver
+	platforms map[string]struct{}
+}
+
+func (client *Client) init(res resolver.Resolver) error {
+	if len(client.Token) == 0 && len(client.Subject) == 0 {
+		return fmt.Errorf("%w: %s: missing token or subject", errInvalidClient, client.ID)
+	}
+
+	var err error
+
+	if client.resolver, err = resolver.Restrict(res, client.Filter); err != nil {
+		return fmt.Errorf("%w: %s: %s", errInvalidClient, client.ID, err.Error())
+	}
+
+	if len(client.Platforms) == 0 {
+		return nil
+	}
+
+	client.platforms = make(map[string]struct{}, len(client.Platforms))
+
+	for _, str := range client.Platforms {
+		platform, err := builder.ParsePlatform(str)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %s", errInvalidClient, client.ID, err.Error())
+		}
+
+		client.platforms[platform.String()] = struct{}{}
+	}
+
+	return nil
+}
+
+// authorize checks whether the client is allowed to build with params.
+func (client *Client) authorize(ctx context.Context, params *Params) error {
+	if client.platforms != nil {
+		if _, found := client.platforms[params.Platform.String()]; !found {
+			return fmt.Errorf("%w: platform %s", errForbidden, params.Platform.String())
+		}
+	}
+
+	if len(client.Filter) == 0 {
+		return nil
+	}
+
+	if err := resolver.Check(ctx, client.resolver, params.ToDependencies()); err != nil {
+		return fmt.Errorf("%w: %s", errForbidden, err.Error())
+	}
+
+	return nil
+}
+
+type auth struct {
+	clients []*Client
+}
+
+func newAuth(clients []*Client, res resolver.Resolver) (*auth, error) {
+	for _, client := range clients {
+		if err := client.init(res); err != nil {
+			return nil, err
+		}
+	}
+
+	return &auth{clients: clients}, nil
+}
+
+// identify returns the client sending the request, or nil if the request is not authenticated.
+func (a *auth) identify(req *http.Request) *Client {
+	if token, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer "); found && len(token) != 0 {
+		for _, client := range a.clients {
+			if len(client.Token) != 0 && subtle.ConstantTimeCompare([]byte(client.Token), []byte(token)) == 1 {
+				return client
+			}
+		}
+
+		return nil
+	}
+
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+
+	subject := req.TLS.VerifiedChains[0][0].Subject.CommonName
+
+	for _, client := range a.clients {
+		if len(client.Subject) != 0 && client.Subject == subject {
+			return client
+		}
+	}
+
+	return nil
+}
+
+// middleware rejects the unauthenticated requests and stores the client in the request context.
+func (a *auth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if publicPath(req.URL.Path) {
+			next.ServeHTTP(res, req)
+
+			return
+		}
+
+		client := a.identify(req)
+		if client == nil {
+			res.Header().Set("WWW-Authenticate", `Bearer realm="k6x"`)
+			http.Error(res, errUnauthorized.Error(), http.StatusUnauthorized)
+
+			return
+		}
+
+		auditFromContext(req.Context()).identify(client, req)
+
+		next.ServeHTTP(res, req.WithContext(withClient(req.Context(), client)))
+	})
+}
+
+// publicPath reports whether the path can be used without authentication (health checks and metrics).
+func publicPath(path string) bool {
+	return path == healthzPath || path == readyzPath || path == metricsPath
+}
+
+type clientKey struct{}
+
+func withClient(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+func clientFromContext(ctx context.Context) *Client {
+	if client, ok := ctx.Value(clientKey{}).(*Client); ok {
+		return client
+	}
+
+	return nil
+}
+
+// defaultAllowedOptions lists the build options the clients may use by default. The cgo (and race, which
+// implies cgo) and ldflags options can make the build run arbitrary programs on the service host,
+// so they have to be allowed by the operator.
+var defaultAllowedOptions = []string{"tags"} //nolint:gochecknoglobals
+
+// allowOptions returns the set of the allowed build options.
+func allowOptions(names []string) map[string]struct{} {
+	if names == nil {
+		names = defaultAllowedOptions
+	}
+
+	allowed := make(map[string]struct{}, len(names))
+
+	for _, name := range names {
+		allowed[name] = struct{}{}
+	}
+
+	return allowed
+}
+
+// authorize checks whether the client of the context is allowed to build with params.
+func (svc *service) authorize(ctx context.Context, params *Params) error {
+	for name := range params.Options.Query() {
+		if _, found := svc.options[name]; !found {
+			return fmt.Errorf("%w: build option %s is not allowed", errForbidden, name)
+		}
+	}
+
+	if svc.auth == nil {
+		return nil
+	}
+
+	client := clientFromContext(ctx)
+	if client == nil {
+		return errUnauthorized
+	}
+
+	return client.authorize(ctx, params)
+}
+
+var (
+	errInvalidClient = errors.New("invalid client")
+	errUnauthorized  = errors.New("unauthorized")
+	errForbidden     = errors.New("forbidden")
+)
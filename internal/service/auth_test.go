@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+
+	clients := []*Client{
+		{ID: "linux", Token: "secret", Platforms: []string{"linux/amd64"}},
+	}
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{Clients: clients})
+	assert.NoError(t, err)
+
+	get := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if len(token) != 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("/linux/amd64/k6@v0.46.0", ""))
+	assert.Equal(t, http.StatusUnauthorized, get("/linux/amd64/k6@v0.46.0", "invalid"))
+	assert.Equal(t, http.StatusOK, get("/linux/amd64/k6@v0.46.0", "secret"))
+	assert.Equal(t, http.StatusForbidden, get("/windows/amd64/k6@v0.46.0", "secret"))
+
+	_, err = New(testResolver{}, testBuilder{}, &Config{Clients: []*Client{{ID: "none"}}})
+	assert.ErrorIs(t, err, errInvalidClient)
+}
+
+func TestAllowedOptions(t *testing.T) {
+	t.Parallel()
+
+	get := func(cfg *Config, path string) int {
+		handler, err := New(testResolver{}, testBuilder{}, cfg)
+		assert.NoError(t, err)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return res.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get(nil, "/linux/amd64/k6@v0.46.0?tags=foo"))
+	assert.Equal(t, http.StatusForbidden, get(nil, "/linux/amd64/k6@v0.46.0?cgo=true"))
+	assert.Equal(t, http.StatusForbidden, get(nil, "/linux/amd64/k6@v0.46.0?ldflags=-s"))
+	assert.Equal(t, http.StatusOK, get(&Config{AllowedOptions: []string{"cgo"}}, "/linux/amd64/k6@v0.46.0?cgo=true"))
+	assert.Equal(t, http.StatusForbidden, get(&Config{AllowedOptions: []string{"cgo"}}, "/linux/amd64/k6@v0.46.0?tags=foo"))
+	assert.Equal(t, http.StatusBadRequest, get(nil, "/linux/amd64/k6@v0.46.0?tags=foo%20-toolexec%3D/x"))
+}
+
+func TestAuthFilterUnsupported(t *testing.T) {
+	t.Parallel()
+
+	// the test resolver doesn't support extension registry filters, the restriction must not fail open
+	_, err := New(testResolver{}, testBuilder{}, &Config{Clients: []*Client{{ID: "c", Token: "t", Filter: "[*]"}}})
+	assert.ErrorIs(t, err, errInvalidClient)
+}
@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/szkiba/k6x/internal/builder"
+	"github.com/szkiba/k6x/internal/dependency"
+)
+
+const (
+	buildPath = "/build"
+
+	maxBuildRequestSize = 64 * 1024
+)
+
+// buildRequest is the JSON body of the POST /build request.
+type buildRequest struct {
+	// Platform is the target platform, in goos/goarch form.
+	Platform *builder.Platform `json:"platform"`
+	// Dependencies maps dependency names to version constraints (or exact versions).
+	Dependencies map[string]string `json:"dependencies"`
+	// Options contains the build options.
+	Options *builder.Options `json:"options,omitempty"`
+	// Download requests the k6 binary in the response instead of a redirect to the canonical URL.
+	Download bool `json:"download,omitempty"`
+	// Replacements are not supported by the service, they are rejected instead of being ignored.
+	Replacements json.RawMessage `json:"replacements,omitempty"`
+}
+
+func (svc *service) serveBuild(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	breq := new(buildRequest)
+
+	decoder := json.NewDecoder(io.LimitReader(req.Body, maxBuildRequestSize))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(breq); err != nil {
+		err = fmt.Errorf("%w: %s", errInvalidBuildRequest, err.Error())
+		svc.error(res, err.Error(), errorStatus(err))
+
+		return
+	}
+
+	params, err := breq.params(req.Context(), svc)
+	if err != nil {
+		svc.error(res, err.Error(), errorStatus(err))
+
+		return
+	}
+
+	log := logrus.WithField("params", params.String())
+
+	if !breq.Download {
+		// the canonical parameters are revealed only to the clients allowed to build them
+		if err := svc.authorize(req.Context(), params); err != nil {
+			log.WithError(err).Warn("authorization error")
+
+			auditFromContext(req.Context()).act(params, "deny")
+			svc.error(res, err.Error(), errorStatus(err))
+
+			return
+		}
+
+		logAction(req.Context(), log, params, "resolve")
+
+		res.Header().Set("Cache-Control", "no-cache,no-store")
+		svc.redirect(res, req, params.String(), http.StatusSeeOther)
+
+		return
+	}
+
+	art, err := svc.build(req.Context(), params, log)
+	if err != nil {
+		svc.error(res, err.Error(), errorStatus(err))
+
+		return
+	}
+
+	svc.metrics.request(outcomeBuild)
+	res.Header().Set("Content-Location", params.String())
+	svc.writeArtifact(res, req, params, art)
+}
+
+// params resolves the dependencies of the request to canonical parameters.
+func (breq *buildRequest) params(ctx context.Context, svc *service) (*Params, error) {
+	if breq.Platform == nil {
+		return nil, fmt.Errorf("%w: missing platform", errInvalidBuildRequest)
+	}
+
+	if !breq.Platform.Supported() {
+		return nil, fmt.Errorf("%w: %s", errInvalidBuildRequest, errUnsupportedPlatform.Error())
+	}
+
+	if len(breq.Replacements) != 0 {
+		return nil, fmt.Errorf("%w: %s", errInvalidBuildRequest, errReplacements.Error())
+	}
+
+	if breq.Options == nil {
+		breq.Options = new(builder.Options)
+	}
+
+	if err := breq.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidBuildRequest, err.Error())
+	}
+
+	deps := make(dependency.Dependencies, len(breq.Dependencies))
+
+	for name, constraints := range breq.Dependencies {
+		dep, err := dependency.New(name, constraints)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidBuildRequest, err.Error())
+		}
+
+		deps[name] = dep
+	}
+
+	if _, has := deps["k6"]; !has {
+		deps["k6"] = &dependency.Dependency{Name: "k6"}
+	}
+
+	mods, err := svc.resolver.Resolve(ctx, deps)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errResolve, err.Error())
+	}
+
+	return &Params{Artifacts: mods.ToArtifacts(), Platform: breq.Platform, Options: breq.Options}, nil
+}
+
+var (
+	errInvalidBuildRequest = errors.New("invalid build request")
+	errReplacements        = errors.New("replacements are not supported by the service")
+)
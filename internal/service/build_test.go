@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeBuild(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(testResolver{}, testBuilder{}, nil)
+	assert.NoError(t, err)
+
+	body := `{"platform":"linux/amd64","dependencies":{"k6/x/faker":">0.2"},"options":{"tags":["foo","bar"]}}`
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/build", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusSeeOther, res.Code)
+	assert.Equal(t, "/linux/amd64/k6@v0.46.0,k6/x/faker@v0.46.0?tags=bar%2Cfoo", res.Header().Get("Location"))
+
+	body = `{"platform":"linux/amd64","download":true}`
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/build", strings.NewReader(body)))
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "k6 for linux/amd64", res.Body.String())
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/build", strings.NewReader(`{"foo":1}`)))
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	for _, body := range []string{
+		`{"platform":"linux/amd64","options":{"tags":["foo -toolexec=/x"]}}`,
+		`{"platform":"linux/amd64","options":{"ldflags":"-s' -toolexec=/x '"}}`,
+		`{"platform":"linux/amd64","replacements":{"k6/x/faker":"../faker"}}`,
+	} {
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/build", strings.NewReader(body)))
+
+		assert.Equal(t, http.StatusBadRequest, res.Code, body)
+	}
+}
+
+func TestServeBuildForbidden(t *testing.T) {
+	t.Parallel()
+
+	clients := []*Client{{ID: "arm", Token: "arm", Platforms: []string{"linux/arm64"}}}
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{Clients: clients})
+	assert.NoError(t, err)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/build", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer arm")
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	res := post(`{"platform":"linux/amd64"}`)
+
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Empty(t, res.Header().Get("Location"))
+
+	res = post(`{"platform":"linux/arm64"}`)
+
+	assert.Equal(t, http.StatusSeeOther, res.Code)
+	assert.Equal(t, "/linux/arm64/k6@v0.46.0", res.Header().Get("Location"))
+}
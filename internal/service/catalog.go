@@ -0,0 +1,170 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/szkiba/k6x/internal/resolver"
+)
+
+const (
+	catalogPath = "/catalog"
+
+	catalogTTL    = 60 * 60 // ~ 1 hour
+	catalogMaxAge = 60 * 5  // ~ 5 mins
+)
+
+// Catalog lists the extensions and versions which can be requested, and the supported platforms.
+type Catalog struct {
+	Platforms  []string                 `json:"platforms"`
+	Extensions []*resolver.CatalogEntry `json:"extensions"`
+	Generated  time.Time                `json:"generated"`
+}
+
+// catalogs caches the catalogs by extension registry filter, because the generation requires many API calls.
+type catalogs struct {
+	mu      sync.Mutex
+	entries map[string]*Catalog
+}
+
+func newCatalogs() *catalogs {
+	return &catalogs{entries: make(map[string]*Catalog)}
+}
+
+func (cs *catalogs) get(ctx context.Context, key string, res resolver.Resolver) (*Catalog, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cat, found := cs.entries[key]; found && time.Since(cat.Generated) < catalogTTL*time.Second {
+		return cat, nil
+	}
+
+	entries, err := resolver.Catalog(ctx, res)
+	if err != nil {
+		return nil, err
+	}
+
+	cat := &Catalog{Extensions: entries, Generated: time.Now()}
+
+	cs.entries[key] = cat
+
+	return cat, nil
+}
+
+// catalog returns the catalog available for the client of the request.
+func (svc *service) catalog(ctx context.Context) (*Catalog, error) {
+	res, key := svc.resolver, ""
+
+	if client := clientFromContext(ctx); client != nil {
+		res, key = client.resolver, client.Filter
+	}
+
+	cat, err := svc.catalogs.get(ctx, key, res)
+	if err != nil {
+		return nil, err
+	}
+
+	platforms := svc.platforms(ctx)
+
+	return &Catalog{Platforms: platforms, Extensions: cat.Extensions, Generated: cat.Generated}, nil
+}
+
+func (svc *service) serveCatalog(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	cat, err := svc.catalog(req.Context())
+	if err != nil {
+		logrus.WithError(err).Error("catalog error")
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	setCatalogHeaders(res, "application/json")
+
+	encoder := json.NewEncoder(res)
+	encoder.SetIndent("", "  ")
+
+	_ = encoder.Encode(cat)
+}
+
+// serveHome serves the human readable HTML index page, based on the catalog.
+func (svc *service) serveHome(res http.ResponseWriter, req *http.Request) {
+	cat, err := svc.catalog(req.Context())
+	if err != nil {
+		logrus.WithError(err).Error("catalog error")
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	setCatalogHeaders(res, "text/html; charset=utf-8")
+
+	if err := homeTemplate.Execute(res, cat); err != nil {
+		logrus.WithError(err).Error("template error")
+	}
+}
+
+func setCatalogHeaders(res http.ResponseWriter, contentType string) {
+	res.Header().Set("Content-Type", contentType)
+	res.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(catalogMaxAge))
+}
+
+//nolint:gochecknoglobals
+var homeTemplate = template.Must(template.New("home").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>k6x builder service</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; vertical-align: top; }
+code { background: #f4f4f4; padding: 0 0.2em; }
+</style>
+</head>
+<body>
+<h1>k6x builder service</h1>
+<p>
+The k6 binary with extensions can be downloaded from the <code>/goos/goarch/dependency-list</code> path, for example:
+{{- with index .Extensions 0}}{{with .Versions}}
+<code>/linux/amd64/k6@{{index . 0}}</code>
+{{- end}}{{end}}
+</p>
+<p>
+The dependencies may also be listed without versions (the latest versions will be used):
+<code>/linux/amd64/{{range $i, $e := .Extensions}}{{if $i}},{{end}}{{with $e.Modules}}{{index . 0}}{{end}}{{if ge $i 2}}{{break}}{{end}}{{end}}</code>
+</p>
+<p>The catalog is also available in <a href="/catalog">JSON format</a>.</p>
+<h2>Platforms</h2>
+<p>{{range $i, $p := .Platforms}}{{if $i}}, {{end}}<code>{{$p}}</code>{{end}}</p>
+<h2>Extensions</h2>
+<table>
+<tr><th>Name</th><th>Dependency</th><th>Description</th><th>Versions</th></tr>
+{{- range .Extensions}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{range $i, $m := .Modules}}{{if $i}}<br>{{end}}<code>{{$m}}</code>{{end}}</td>
+<td>{{.Description}}</td>
+<td>{{range $i, $v := .Versions}}{{if $i}}, {{end}}{{if ge $i 5}}&hellip;{{break}}{{end}}{{$v}}{{end}}</td>
+</tr>
+{{- end}}
+</table>
+<p><small>Generated at {{.Generated.UTC.Format "2006-01-02 15:04:05 MST"}}</small></p>
+</body>
+</html>
+`))
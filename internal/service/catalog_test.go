@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/k6x/internal/resolver"
+)
+
+func TestHomeTemplate(t *testing.T) {
+	t.Parallel()
+
+	cat := &Catalog{
+		Platforms: []string{"linux/amd64", "windows/amd64"},
+		Extensions: []*resolver.CatalogEntry{
+			{Name: "k6", Modules: []string{"k6"}, Versions: []string{"v0.46.0", "v0.45.1"}},
+			{Name: "xk6-faker", Modules: []string{"k6/x/faker"}, Versions: []string{"v0.2.2"}},
+		},
+		Generated: time.Now(),
+	}
+
+	var buff strings.Builder
+
+	assert.NoError(t, homeTemplate.Execute(&buff, cat))
+
+	assert.Contains(t, buff.String(), "<code>/linux/amd64/k6@v0.46.0</code>")
+	assert.Contains(t, buff.String(), "<code>/linux/amd64/k6,k6/x/faker</code>")
+	assert.Contains(t, buff.String(), "<code>windows/amd64</code>")
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/szkiba/k6x/internal/builder"
+)
+
+const (
+	checksumHeader  = "X-Checksum-Sha256"
+	signatureHeader = "X-Signature-Ed25519"
+
+	checksumSuffix  = ".sha256"
+	signatureSuffix = ".sig"
+)
+
+// checksum returns the SHA-256 digest of the k6 binary.
+func checksum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+
+	return sum[:]
+}
+
+// sign returns the detached signature of the k6 binary, or nil if there is no signing key.
+// The signature is calculated over the SHA-256 digest of the k6 binary and the canonical build path.
+func (svc *service) sign(params *Params, art *artifact) []byte {
+	if svc.signingKey == nil {
+		return nil
+	}
+
+	return ed25519.Sign(svc.signingKey, builder.SignedMessage(art.digest, params.String()))
+}
+
+// setDigestHeaders sets the checksum and signature headers of the (uncompressed) k6 binary.
+func (svc *service) setDigestHeaders(res http.ResponseWriter, params *Params, art *artifact) {
+	res.Header().Set(checksumHeader, hex.EncodeToString(art.digest))
+
+	if sig := svc.sign(params, art); sig != nil {
+		res.Header().Set(signatureHeader, base64.StdEncoding.EncodeToString(sig))
+	}
+}
+
+// sidecar splits the checksum or signature sidecar suffix from the path.
+func sidecar(path string) (string, string) {
+	for _, suffix := range []string{checksumSuffix, signatureSuffix} {
+		if trimmed, found := strings.CutSuffix(path, suffix); found {
+			return trimmed, suffix
+		}
+	}
+
+	return path, ""
+}
+
+// withSidecar appends the sidecar suffix to the path part of the location.
+func withSidecar(loc string, suffix string) string {
+	path, query, found := strings.Cut(loc, "?")
+	if !found {
+		return path + suffix
+	}
+
+	return path + suffix + "?" + query
+}
+
+// writeSidecar writes the checksum (in sha256sum format) or the raw signature of the k6 binary.
+func (svc *service) writeSidecar(res http.ResponseWriter, req *http.Request, params *Params, art *artifact, suffix string) {
+	var data []byte
+
+	if suffix == checksumSuffix {
+		data = []byte(fmt.Sprintf("%s  %s\n", hex.EncodeToString(art.digest), binaryName(params)))
+
+		res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		if data = svc.sign(params, art); data == nil {
+			http.Error(res, errNoSigningKey.Error(), http.StatusNotFound)
+
+			return
+		}
+
+		res.Header().Set("Content-Type", "application/octet-stream")
+	}
+
+	auditFromContext(req.Context()).served(art)
+
+	svc.setCacheControl(res)
+	res.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	res.Header().Set("ETag", params.ETag()+suffix)
+
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	_, _ = res.Write(data)
+}
+
+var errNoSigningKey = errors.New("signing is not enabled")
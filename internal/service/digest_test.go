@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/k6x/internal/builder"
+	"github.com/szkiba/k6x/internal/dependency"
+)
+
+func TestServeDigest(t *testing.T) {
+	t.Parallel()
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{SigningKey: key})
+	assert.NoError(t, err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return res
+	}
+
+	digest := sha256.Sum256([]byte("k6 for linux/amd64"))
+
+	res := get("/linux/amd64/k6@v0.46.0")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, hex.EncodeToString(digest[:]), res.Header().Get(checksumHeader))
+
+	sig, err := base64.StdEncoding.DecodeString(res.Header().Get(signatureHeader))
+	assert.NoError(t, err)
+	assert.True(t, ed25519.Verify(pub, builder.SignedMessage(digest[:], "/linux/amd64/k6@v0.46.0"), sig))
+	assert.False(t, ed25519.Verify(pub, digest[:], sig))
+
+	res = get("/linux/amd64/k6@v0.46.0.sha256")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, hex.EncodeToString(digest[:])+"  k6\n", res.Body.String())
+
+	res = get("/linux/amd64/k6@v0.46.0.sig")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, sig, res.Body.Bytes())
+
+	res = get("/linux/amd64/k6@0.46.0.sha256")
+	assert.Equal(t, http.StatusMovedPermanently, res.Code)
+	assert.Equal(t, "/linux/amd64/k6@v0.46.0.sha256", res.Header().Get("Location"))
+}
+
+func TestSignatureReplay(t *testing.T) {
+	t.Parallel()
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{SigningKey: key})
+	assert.NoError(t, err)
+
+	defer Drain(context.Background(), handler) //nolint:errcheck
+
+	// the malicious proxy serves the (validly signed) k6 binary of other build parameters
+	proxy := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		req.URL.Path = strings.Replace(req.URL.Path, ",k6/x/faker@v0.2.2", "", 1)
+		handler.ServeHTTP(res, req)
+	}))
+	defer proxy.Close()
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	assert.NoError(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "signing.pub")
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	b, err := builder.NewServiceBuilder(context.Background(), &builder.ServiceConfig{
+		Endpoints: []string{proxy.URL},
+		PublicKey: keyFile,
+	})
+	assert.NoError(t, err)
+
+	k6, err := dependency.NewModule("k6", "v0.46.0", "go.k6.io/k6")
+	assert.NoError(t, err)
+
+	faker, err := dependency.NewModule("k6/x/faker", "v0.2.2", "github.com/szkiba/xk6-faker")
+	assert.NoError(t, err)
+
+	platform := builder.NewPlatform("linux", "amd64")
+
+	var out bytes.Buffer
+
+	_, err = b.Build(context.Background(), platform, dependency.Modules{k6.Name: k6}, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, "k6 for linux/amd64", out.String())
+
+	out.Reset()
+
+	_, err = b.Build(context.Background(), platform, dependency.Modules{k6.Name: k6, faker.Name: faker}, &out)
+	assert.Error(t, err)
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// tracker counts the in-flight builds and jobs, so the shutdown can wait for them.
+type tracker struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{}
+}
+
+// start registers an in-flight operation, the returned function marks it finished.
+func (t *tracker) start() func() {
+	t.mu.Lock()
+	t.active++
+	t.mu.Unlock()
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.active--
+		if t.active == 0 && t.idle != nil {
+			close(t.idle)
+			t.idle = nil
+		}
+	}
+}
+
+// wait waits until there are no in-flight operations or the context is done.
+func (t *tracker) wait(ctx context.Context) error {
+	t.mu.Lock()
+
+	if t.active == 0 {
+		t.mu.Unlock()
+
+		return nil
+	}
+
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+
+	idle := t.idle
+
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drainer is implemented by the handler returned by New.
+type drainer interface {
+	drain(ctx context.Context) error
+}
+
+type drainHandler struct {
+	http.Handler
+	svc *service
+}
+
+func (h *drainHandler) drain(ctx context.Context) error {
+	err := h.svc.running.wait(ctx)
+
+	h.svc.jobs.discard()
+
+	return err
+}
+
+// Drain waits until the in-flight builds and jobs of the service handler (returned by New) are finished,
+// or the context is done, and removes the artifacts of the jobs. It should be called after the HTTP server
+// has been shut down.
+func Drain(ctx context.Context, handler http.Handler) error {
+	if d, ok := handler.(drainer); ok {
+		return d.drain(ctx)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+
+	track := new(tracker)
+
+	assert.NoError(t, track.wait(context.Background()))
+
+	done := track.start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, track.wait(ctx), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		done()
+	}()
+
+	assert.NoError(t, track.wait(context.Background()))
+}
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{MaxAge: time.Minute, MaxAgeStale: time.Second})
+	assert.NoError(t, err)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/jobs/linux/amd64/k6@v0.46.0", nil))
+
+	assert.Equal(t, http.StatusAccepted, res.Code)
+	assert.NoError(t, Drain(context.Background(), handler))
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/linux/amd64/k6@v0.46.0", nil))
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t,
+		"public, max-age=60, immutable, stale-while-revalidate=1, stale-if-error=1",
+		res.Header().Get("Cache-Control"),
+	)
+
+	assert.NoError(t, Drain(context.Background(), http.NotFoundHandler()))
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// content encodings of the precomputed compressed variants, in order of preference
+const (
+	encodingZstd = "zstd"
+	encodingGzip = "gzip"
+)
+
+//nolint:gochecknoglobals
+var (
+	encodings = []string{encodingZstd, encodingGzip}
+
+	encodingSuffixes = map[string]string{encodingZstd: ".zst", encodingGzip: ".gz"}
+)
+
+// compress returns the compressed variants of data by content encoding.
+func compress(data []byte) (map[string][]byte, error) {
+	variants := make(map[string][]byte, len(encodings))
+
+	for _, encoding := range encodings {
+		var buff bytes.Buffer
+
+		writer, err := newEncoder(encoding, &buff)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = writer.Write(data); err != nil {
+			return nil, err
+		}
+
+		if err = writer.Close(); err != nil {
+			return nil, err
+		}
+
+		variants[encoding] = buff.Bytes()
+	}
+
+	return variants, nil
+}
+
+func newEncoder(encoding string, out io.Writer) (io.WriteCloser, error) {
+	if encoding == encodingZstd {
+		return zstd.NewWriter(out, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	}
+
+	return gzip.NewWriterLevel(out, gzip.DefaultCompression)
+}
+
+// negotiateEncoding returns the preferred content encoding accepted by the client,
+// or an empty string if the content should not be compressed.
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		q := 1.0
+
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			var err error
+
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		for _, encoding := range encodings {
+			if (name == encoding || name == "*") && q > 0 && (q > bestQ || (q == bestQ && preferred(encoding, best))) {
+				best, bestQ = encoding, q
+			}
+		}
+	}
+
+	return best
+}
+
+// preferred reports whether encoding is preferred over other.
+func preferred(encoding, other string) bool {
+	for _, enc := range encodings {
+		if enc == encoding {
+			return true
+		}
+
+		if enc == other {
+			return false
+		}
+	}
+
+	return false
+}
+
+// matchETag reports whether the If-None-Match header value matches the ETag of any variant of the k6 binary.
+func (pars *Params) matchETag(value string) bool {
+	etag := pars.ETag()
+	if value == etag {
+		return true
+	}
+
+	for _, encoding := range encodings {
+		if value == etag+"-"+encoding {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "", negotiateEncoding(""))
+	assert.Equal(t, "", negotiateEncoding("br, deflate"))
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, deflate"))
+	assert.Equal(t, "zstd", negotiateEncoding("gzip, zstd"))
+	assert.Equal(t, "gzip", negotiateEncoding("gzip;q=1.0, zstd;q=0.5"))
+	assert.Equal(t, "zstd", negotiateEncoding("*"))
+	assert.Equal(t, "", negotiateEncoding("gzip;q=0"))
+}
+
+func TestServeEncoded(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{StoreDir: t.TempDir()})
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ { // build, then from store
+		req := httptest.NewRequest(http.MethodGet, "/linux/amd64/k6@v0.46.0", nil)
+		req.Header.Set("Accept-Encoding", "gzip, zstd")
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "zstd", res.Header().Get("Content-Encoding"))
+
+		decoder, err := zstd.NewReader(res.Body)
+		assert.NoError(t, err)
+
+		data, err := io.ReadAll(decoder)
+		assert.NoError(t, err)
+		assert.Equal(t, "k6 for linux/amd64", string(data))
+
+		decoder.Close()
+	}
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// flight coalesces concurrent builds with the same key, so one build serves all waiters.
+// The build is canceled only when all of its waiters are gone.
+type flight struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+
+	art *artifact
+	err error
+}
+
+func newFlight() *flight {
+	return &flight{calls: make(map[string]*call)}
+}
+
+// do calls fn unless a call with the same key is already in flight, and waits for the result.
+// The shared return value reports whether the result was produced by an other request's call.
+func (fl *flight) do(
+	ctx context.Context,
+	key string,
+	fn func(ctx context.Context) (*artifact, error),
+) (art *artifact, shared bool, err error) {
+	fl.mu.Lock()
+
+	c, shared := fl.calls[key]
+	if !shared {
+		cctx, cancel := context.WithCancel(context.Background())
+
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		fl.calls[key] = c
+
+		go fl.run(cctx, key, c, fn)
+	}
+
+	c.waiters++
+
+	fl.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.art, shared, c.err
+	case <-ctx.Done():
+		fl.leave(key, c)
+
+		return nil, shared, ctx.Err()
+	}
+}
+
+func (fl *flight) run(ctx context.Context, key string, c *call, fn func(ctx context.Context) (*artifact, error)) {
+	defer close(c.done)
+	defer c.cancel()
+
+	c.art, c.err = fn(ctx)
+
+	fl.mu.Lock()
+	if fl.calls[key] == c {
+		delete(fl.calls, key)
+	}
+	fl.mu.Unlock()
+}
+
+func (fl *flight) leave(key string, c *call) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	c.waiters--
+	if c.waiters != 0 {
+		return
+	}
+
+	c.cancel()
+
+	if fl.calls[key] == c {
+		delete(fl.calls, key)
+	}
+}
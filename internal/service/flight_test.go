@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlight(t *testing.T) {
+	t.Parallel()
+
+	fl := newFlight()
+
+	var calls int32
+
+	release := make(chan struct{})
+
+	fn := func(ctx context.Context) (*artifact, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		return &artifact{data: []byte("k6")}, nil
+	}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			art, _, err := fl.do(context.Background(), "key", fn)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("k6"), art.data)
+		}()
+	}
+
+	for {
+		fl.mu.Lock()
+		waiters := 0
+		if c, found := fl.calls["key"]; found {
+			waiters = c.waiters
+		}
+		fl.mu.Unlock()
+
+		if waiters == 10 {
+			break
+		}
+	}
+
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestFlightCancel(t *testing.T) {
+	t.Parallel()
+
+	fl := newFlight()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan struct{})
+
+	cancel()
+
+	_, _, err := fl.do(ctx, "key", func(ctx context.Context) (*artifact, error) {
+		<-ctx.Done()
+		close(canceled)
+
+		return nil, ctx.Err()
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+
+	<-canceled
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/szkiba/k6x/internal/builder"
+)
+
+const infoPath = "/info"
+
+// service statuses
+const (
+	StatusOK       = "ok"
+	StatusDisabled = "disabled"
+)
+
+// Info describes the service for the clients, so they can decide whether to use it.
+type Info struct {
+	Version   string   `json:"version"`
+	Status    string   `json:"status"`
+	Platforms []string `json:"platforms"`
+	Limits    *Limits  `json:"limits"`
+}
+
+// Limits contains the limits of the service.
+type Limits struct {
+	// StoreSize is the size limit of the artifact store in bytes (zero means unlimited or no store).
+	StoreSize int64 `json:"storeSize"`
+	// JobRetention is the time while the finished jobs are kept, in seconds.
+	JobRetention int `json:"jobRetention"`
+	// RateLimit is the allowed request rate of the client (requests per second, zero means unlimited).
+	RateLimit float64 `json:"rateLimit"`
+	// RateBurst is the allowed request burst of the client.
+	RateBurst int `json:"rateBurst"`
+	// MaxBuilds is the allowed number of concurrent builds of the client (zero means unlimited).
+	MaxBuilds int `json:"maxBuilds"`
+}
+
+// platforms returns the platforms allowed for the client of the context.
+func (svc *service) platforms(ctx context.Context) []string {
+	var allowed map[string]struct{}
+
+	if client := clientFromContext(ctx); client != nil {
+		allowed = client.platforms
+	}
+
+	platforms := make([]string, 0, len(builder.SupportedPlatforms()))
+
+	for _, platform := range builder.SupportedPlatforms() {
+		if allowed != nil {
+			if _, found := allowed[platform.String()]; !found {
+				continue
+			}
+		}
+
+		platforms = append(platforms, platform.String())
+	}
+
+	return platforms
+}
+
+func (svc *service) serveInfo(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	info := &Info{
+		Version:   svc.version,
+		Status:    StatusOK,
+		Platforms: svc.platforms(req.Context()),
+		Limits:    &Limits{JobRetention: jobRetention},
+	}
+
+	if svc.disabled {
+		info.Status = StatusDisabled
+	}
+
+	if svc.store != nil {
+		info.Limits.StoreSize = svc.store.limit
+	}
+
+	if svc.limits != nil {
+		info.Limits.RateLimit, info.Limits.RateBurst, info.Limits.MaxBuilds = svc.limits.limitsOf(
+			clientFromContext(req.Context()),
+		)
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", "no-cache,no-store")
+
+	encoder := json.NewEncoder(res)
+	encoder.SetIndent("", "  ")
+
+	_ = encoder.Encode(info)
+}
@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeInfo(t *testing.T) {
+	t.Parallel()
+
+	clients := []*Client{
+		{ID: "linux", Token: "secret", Platforms: []string{"linux/amd64"}},
+	}
+
+	for _, disabled := range []bool{false, true} {
+		handler, err := New(testResolver{}, testBuilder{}, &Config{Clients: clients, Version: "v1.2.3", Disabled: disabled})
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/info", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+
+		info := new(Info)
+
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), info))
+		assert.Equal(t, "v1.2.3", info.Version)
+		assert.Equal(t, []string{"linux/amd64"}, info.Platforms)
+		assert.Equal(t, jobRetention, info.Limits.JobRetention)
+
+		if disabled {
+			assert.Equal(t, StatusDisabled, info.Status)
+		} else {
+			assert.Equal(t, StatusOK, info.Status)
+		}
+	}
+}
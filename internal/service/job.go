@@ -0,0 +1,454 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	jobsPrefix = "/jobs"
+
+	jobRetention = 60 * 60 // ~ 1 hour
+	jobLogSize   = 100
+)
+
+// JobStatus is the state of a build job.
+type JobStatus string
+
+const (
+	JobPending  JobStatus = "pending"
+	JobBuilding JobStatus = "building"
+	JobDone     JobStatus = "done"
+	JobFailed   JobStatus = "failed"
+)
+
+// job is an asynchronous build started by a POST request. Jobs are identified by the ETag of the parameters,
+// so concurrent requests for the same parameters share the job.
+type job struct {
+	mu sync.Mutex
+
+	ID       string     `json:"id"`
+	Params   string     `json:"params"`
+	Status   JobStatus  `json:"status"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Cached   bool       `json:"cached"`
+	Size     int64      `json:"size,omitempty"`
+	Checksum string     `json:"checksum,omitempty"`
+	Log      []string   `json:"log"`
+	Artifact string     `json:"artifact,omitempty"`
+
+	params *Params
+	// art is the k6 binary of the finished job, it is kept in temporary files until the job expires
+	art *artifact
+}
+
+func (j *job) logf(format string, args ...interface{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	line := time.Now().UTC().Format(time.RFC3339) + " " + fmt.Sprintf(format, args...)
+
+	j.Log = append(j.Log, line)
+	if len(j.Log) > jobLogSize {
+		j.Log = j.Log[len(j.Log)-jobLogSize:]
+	}
+}
+
+func (j *job) setStatus(status JobStatus) {
+	j.mu.Lock()
+	j.Status = status
+	j.mu.Unlock()
+
+	j.logf("%s", status)
+}
+
+func (j *job) finish(art *artifact, err error) {
+	j.mu.Lock()
+
+	now := time.Now()
+	j.Finished = &now
+
+	if err != nil {
+		j.Status = JobFailed
+		j.Error = err.Error()
+	} else {
+		j.Status = JobDone
+		j.art = art
+		j.Cached = art.cached
+		j.Size = art.size
+		j.Checksum = hex.EncodeToString(art.digest)
+		j.Artifact = jobsPrefix + "/" + j.ID + "/artifact"
+	}
+
+	status := j.Status
+
+	j.mu.Unlock()
+
+	if err != nil {
+		j.logf("%s: %s", status, err.Error())
+	} else {
+		j.logf("%s", status)
+	}
+}
+
+// discard removes the temporary files of the job artifact.
+func (j *job) discard() {
+	j.mu.Lock()
+	art := j.art
+	j.art = nil
+	j.mu.Unlock()
+
+	if art != nil {
+		removeArtifact(art)
+	}
+}
+
+// keepArtifact copies the k6 binary and its compressed variants into temporary files, so the artifact
+// of the job can be downloaded without rebuilding it, even if it is not in the artifact store.
+func keepArtifact(art *artifact) (*artifact, error) {
+	kept := &artifact{
+		size:     art.size,
+		digest:   art.digest,
+		manifest: art.manifest,
+		cached:   art.cached,
+		variants: make(map[string]string, len(encodings)),
+	}
+
+	var err error
+
+	if kept.file, err = copyContent(art, ""); err != nil {
+		return nil, err
+	}
+
+	for _, encoding := range encodings {
+		name, err := copyContent(art, encoding)
+		if err != nil {
+			removeArtifact(kept)
+
+			return nil, err
+		}
+
+		if len(name) != 0 {
+			kept.variants[encoding] = name
+		}
+	}
+
+	return kept, nil
+}
+
+// removeArtifact removes the temporary files of the artifact kept by keepArtifact.
+func removeArtifact(art *artifact) {
+	_ = os.Remove(art.file)
+
+	for _, name := range art.variants {
+		_ = os.Remove(name)
+	}
+}
+
+// copyContent copies the k6 binary, or its compressed variant, into a temporary file and returns its name.
+// The name is empty if the compressed variant is not available.
+func copyContent(art *artifact, encoding string) (string, error) {
+	body, _, actual, err := art.open(encoding)
+	if err != nil {
+		return "", err
+	}
+
+	defer body.Close() //nolint:errcheck
+
+	if actual != encoding {
+		return "", nil
+	}
+
+	tmp, err := os.CreateTemp("", "k6x-job-*"+encodingSuffixes[encoding])
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(tmp, body)
+
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
+
+func (j *job) is(status JobStatus) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.Status == status
+}
+
+func (j *job) expired(now time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.Finished != nil && now.Sub(*j.Finished) > jobRetention*time.Second
+}
+
+func (j *job) write(res http.ResponseWriter, status int) {
+	j.mu.Lock()
+	data, err := json.MarshalIndent(j, "", "  ")
+	j.mu.Unlock()
+
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	res.Header().Set("Cache-Control", "no-cache,no-store")
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+
+	_, _ = res.Write(data)
+}
+
+type jobs struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+func newJobs() *jobs {
+	return &jobs{jobs: make(map[string]*job)}
+}
+
+// start returns the job for params, a new job is started if there is no such job.
+func (js *jobs) start(params *Params, build func(j *job) (*artifact, error)) (*job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	js.sweep()
+
+	id := params.ETag()
+
+	if j, found := js.jobs[id]; found && !j.is(JobFailed) {
+		return j, false
+	}
+
+	j := &job{
+		ID:      id,
+		Params:  params.String(),
+		Status:  JobPending,
+		Created: time.Now(),
+		Log:     []string{},
+		params:  params,
+	}
+
+	j.logf("%s", JobPending)
+
+	js.jobs[id] = j
+
+	go func() {
+		j.finish(build(j))
+	}()
+
+	return j, true
+}
+
+func (js *jobs) get(id string) *job {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	js.sweep()
+
+	return js.jobs[id]
+}
+
+// sweep removes the expired jobs. Must be called with mu held.
+func (js *jobs) sweep() {
+	now := time.Now()
+
+	for id, j := range js.jobs {
+		if j.expired(now) {
+			delete(js.jobs, id)
+			j.discard()
+		}
+	}
+}
+
+// discard removes the temporary files of all jobs (e.g. on shutdown).
+func (js *jobs) discard() {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	for _, j := range js.jobs {
+		j.discard()
+	}
+}
+
+func (svc *service) serveJobs(res http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		svc.startJob(res, req)
+	case http.MethodGet, http.MethodHead:
+		svc.getJob(res, req)
+	default:
+		res.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (svc *service) startJob(res http.ResponseWriter, req *http.Request) {
+	params, err := parseParams(req.URL)
+	if errors.Is(err, errInvalidParameters) {
+		params, err = looseParseParams(req.Context(), req.URL, svc.resolver)
+	}
+
+	if err != nil {
+		svc.error(res, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	svc.submit(res, req, params)
+}
+
+// submit starts (or joins) the build job of params and responds with the job status.
+func (svc *service) submit(res http.ResponseWriter, req *http.Request, params *Params) {
+	if err := svc.authorize(req.Context(), params); err != nil {
+		svc.error(res, err.Error(), errorStatus(err))
+
+		return
+	}
+
+	log := logrus.WithField("params", params.String())
+
+	// the build slot is taken while submitting, so the quota error is returned to the client
+	release, err := svc.limits.acquire(req.Context())
+	if err != nil {
+		svc.error(res, err.Error(), errorStatus(err))
+
+		return
+	}
+
+	// the job outlives the request, but keeps its client
+	ctx := withClient(context.Background(), clientFromContext(req.Context()))
+	ctx = withSlot(withLimitKey(ctx, limitKeyFromContext(req.Context())))
+
+	// the job is tracked from the start, so the shutdown waits for it
+	done := svc.running.start()
+
+	j, started := svc.jobs.start(params, func(j *job) (*artifact, error) {
+		defer done()
+		defer release()
+
+		j.setStatus(JobBuilding)
+
+		art, err := svc.build(ctx, params, log.WithField("job", j.ID))
+		if err != nil {
+			return nil, err
+		}
+
+		return keepArtifact(art)
+	})
+
+	if started {
+		logAction(req.Context(), log.WithField("job", j.ID), params, "job")
+	} else {
+		release()
+		done()
+		auditFromContext(req.Context()).act(params, "job")
+	}
+
+	status := http.StatusAccepted
+	if j.is(JobDone) {
+		status = http.StatusOK
+	}
+
+	svc.metrics.request(outcomeJob)
+	res.Header().Set("Location", jobsPrefix+"/"+j.ID)
+	j.write(res, status)
+}
+
+func (svc *service) getJob(res http.ResponseWriter, req *http.Request) {
+	id, rest, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+
+	j := svc.jobs.get(id)
+	if j == nil {
+		http.Error(res, errJobNotFound.Error(), http.StatusNotFound)
+
+		return
+	}
+
+	if err := svc.authorize(req.Context(), j.params); err != nil {
+		http.Error(res, err.Error(), errorStatus(err))
+
+		return
+	}
+
+	auditFromContext(req.Context()).act(j.params, "job")
+
+	switch rest {
+	case "":
+		j.write(res, http.StatusOK)
+	case "artifact", "artifact" + checksumSuffix, "artifact" + signatureSuffix:
+		svc.serveJobArtifact(res, req, j, strings.TrimPrefix(rest, "artifact"))
+	default:
+		http.NotFound(res, req)
+	}
+}
+
+// serveJobArtifact serves the k6 binary of a finished job from the temporary files of the job.
+// The artifact is not rebuilt, if its files are gone the response is 410 Gone.
+func (svc *service) serveJobArtifact(res http.ResponseWriter, req *http.Request, j *job, suffix string) {
+	j.mu.Lock()
+	status, art := j.Status, j.art
+	j.mu.Unlock()
+
+	if status != JobDone {
+		http.Error(res, fmt.Sprintf("%s: %s", errJobNotDone.Error(), status), http.StatusConflict)
+
+		return
+	}
+
+	if art == nil || !exists(art.file) {
+		svc.error(res, errJobArtifactGone.Error(), http.StatusGone)
+
+		return
+	}
+
+	if len(suffix) != 0 {
+		svc.writeSidecar(res, req, j.params, art, suffix)
+
+		return
+	}
+
+	svc.writeArtifact(res, req, j.params, art)
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+
+	return err == nil
+}
+
+var (
+	errJobNotFound = errors.New("job not found")
+	errJobNotDone  = errors.New("job is not done")
+
+	errJobArtifactGone = errors.New("job artifact is gone")
+)
@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/k6x/internal/builder"
+	"github.com/szkiba/k6x/internal/dependency"
+)
+
+type testResolver struct{}
+
+func (testResolver) Resolve(_ context.Context, deps dependency.Dependencies) (dependency.Modules, error) {
+	mods := make(dependency.Modules)
+
+	for name := range deps {
+		mod, err := dependency.NewModule(name, "v0.46.0", "example.com/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		mods[name] = mod
+	}
+
+	return mods, nil
+}
+
+func (testResolver) Starred(_ context.Context, _ int) (dependency.Modules, error) {
+	return nil, nil
+}
+
+type testBuilder struct{}
+
+func (testBuilder) Engine() builder.Engine {
+	return builder.Native
+}
+
+func (testBuilder) Build(
+	_ context.Context,
+	platform *builder.Platform,
+	_ dependency.Modules,
+	out io.Writer,
+) (*builder.Manifest, error) {
+	_, err := io.WriteString(out, "k6 for "+platform.String())
+
+	return &builder.Manifest{Engine: builder.Native, Platform: platform}, err
+}
+
+func TestJobs(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(testResolver{}, testBuilder{}, nil)
+	assert.NoError(t, err)
+
+	defer Drain(context.Background(), handler) //nolint:errcheck
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/jobs/linux/amd64/k6@v0.46.0", "", nil) //nolint:noctx
+	assert.NoError(t, err)
+	assert.Contains(t, []int{http.StatusOK, http.StatusAccepted}, resp.StatusCode)
+
+	status := new(job)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(status))
+	assert.NoError(t, resp.Body.Close())
+
+	loc := resp.Header.Get("Location")
+	assert.Equal(t, "/jobs/"+status.ID, loc)
+
+	for status.Status != JobDone {
+		assert.NotEqual(t, JobFailed, status.Status)
+
+		time.Sleep(10 * time.Millisecond)
+
+		resp, err = http.Get(srv.URL + loc) //nolint:noctx
+		assert.NoError(t, err)
+
+		status = new(job)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(status))
+		assert.NoError(t, resp.Body.Close())
+	}
+
+	resp, err = http.Get(srv.URL + status.Artifact) //nolint:noctx
+	assert.NoError(t, err)
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "k6 for linux/amd64", string(body))
+
+	resp, err = http.Get(srv.URL + "/jobs/unknown") //nolint:noctx
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+type countingBuilder struct {
+	testBuilder
+	builds atomic.Int32
+}
+
+func (b *countingBuilder) Build(
+	ctx context.Context,
+	platform *builder.Platform,
+	mods dependency.Modules,
+	out io.Writer,
+) (*builder.Manifest, error) {
+	b.builds.Add(1)
+
+	return b.testBuilder.Build(ctx, platform, mods, out)
+}
+
+func TestJobArtifact(t *testing.T) {
+	t.Parallel()
+
+	b := new(countingBuilder)
+
+	handler, err := New(testResolver{}, b, nil)
+	assert.NoError(t, err)
+
+	svc := handler.(*drainHandler).svc //nolint:forcetypeassert
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(method, path, nil))
+
+		return res
+	}
+
+	loc := do(http.MethodPost, "/jobs/linux/amd64/k6@v0.46.0").Header().Get("Location")
+
+	var j *job
+
+	for j = svc.jobs.get(strings.TrimPrefix(loc, jobsPrefix+"/")); !j.is(JobDone); {
+		assert.False(t, j.is(JobFailed))
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the artifact is served from the files of the job, without rebuilding it
+	for i := 0; i < 2; i++ {
+		res := do(http.MethodGet, loc+"/artifact")
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "k6 for linux/amd64", res.Body.String())
+	}
+
+	assert.Equal(t, int32(1), b.builds.Load())
+
+	file := j.art.file
+
+	assert.FileExists(t, file)
+
+	svc.jobs.discard()
+
+	assert.NoFileExists(t, file)
+	assert.Equal(t, http.StatusGone, do(http.MethodGet, loc+"/artifact").Code)
+	assert.Equal(t, int32(1), b.builds.Load())
+}
@@ -0,0 +1,241 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// limitRetention is the idle time after which the state of a client is forgotten.
+	limitRetention = 10 * time.Minute
+	// quotaRetryAfter is the suggested delay after exceeding the build quota, in seconds.
+	quotaRetryAfter = 30
+)
+
+// limits applies the per client request rate limits and concurrent build quotas.
+// Clients are identified by the authenticated client ID, or by the IP address.
+type limits struct {
+	rate      float64
+	burst     int
+	maxBuilds int
+
+	mu      sync.Mutex
+	clients map[string]*clientLimits
+}
+
+type clientLimits struct {
+	limiter *rate.Limiter
+	builds  int
+	seen    time.Time
+}
+
+func newLimits(cfg *Config) *limits {
+	return &limits{
+		rate:      cfg.RateLimit,
+		burst:     cfg.RateBurst,
+		maxBuilds: cfg.ClientBuilds,
+		clients:   make(map[string]*clientLimits),
+	}
+}
+
+// limitsOf returns the limits of the client (the client specific limits override the service limits).
+func (l *limits) limitsOf(client *Client) (float64, int, int) {
+	rateLimit, burst, maxBuilds := l.rate, l.burst, l.maxBuilds
+
+	if client != nil {
+		if client.RateLimit != 0 {
+			rateLimit = client.RateLimit
+		}
+
+		if client.RateBurst != 0 {
+			burst = client.RateBurst
+		}
+
+		if client.MaxBuilds != 0 {
+			maxBuilds = client.MaxBuilds
+		}
+	}
+
+	if rateLimit > 0 && burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rateLimit)))
+	}
+
+	return rateLimit, burst, maxBuilds
+}
+
+// get returns the state of the client with the given key. Must be called with mu held.
+func (l *limits) get(key string, client *Client) *clientLimits {
+	now := time.Now()
+
+	for k, state := range l.clients {
+		if state.builds == 0 && now.Sub(state.seen) > limitRetention {
+			delete(l.clients, k)
+		}
+	}
+
+	state, found := l.clients[key]
+	if !found {
+		state = new(clientLimits)
+
+		if rateLimit, burst, _ := l.limitsOf(client); rateLimit > 0 {
+			state.limiter = rate.NewLimiter(rate.Limit(rateLimit), burst)
+		}
+
+		l.clients[key] = state
+	}
+
+	state.seen = now
+
+	return state
+}
+
+// allow checks the request rate limit of the client, returns the delay after which the request would be allowed.
+func (l *limits) allow(key string, client *Client) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.get(key, client)
+	if state.limiter == nil {
+		return 0, true
+	}
+
+	reservation := state.limiter.Reserve()
+	if !reservation.OK() {
+		return limitRetention, false
+	}
+
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+
+		return delay, false
+	}
+
+	return 0, true
+}
+
+// acquire takes a build slot of the client of the context, the returned function releases it.
+// No slot is taken if the context already holds one (e.g. the build of a job).
+func (l *limits) acquire(ctx context.Context) (func(), error) {
+	if l == nil || ctx.Value(slotKey{}) != nil {
+		return func() {}, nil
+	}
+
+	key, client := limitKeyFromContext(ctx), clientFromContext(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.get(key, client)
+
+	if _, _, maxBuilds := l.limitsOf(client); maxBuilds > 0 && state.builds >= maxBuilds {
+		return nil, fmt.Errorf("%w: %d concurrent builds", errQuotaExceeded, maxBuilds)
+	}
+
+	state.builds++
+
+	return func() {
+		l.mu.Lock()
+		state.builds--
+		l.mu.Unlock()
+	}, nil
+}
+
+// middleware rejects the requests exceeding the rate limit and stores the limit key in the request context.
+func (l *limits) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if publicPath(req.URL.Path) {
+			next.ServeHTTP(res, req)
+
+			return
+		}
+
+		client := clientFromContext(req.Context())
+		key := limitKey(req, client)
+
+		if delay, ok := l.allow(key, client); !ok {
+			setRetryAfter(res, delay)
+			http.Error(res, errRateLimited.Error(), http.StatusTooManyRequests)
+
+			return
+		}
+
+		next.ServeHTTP(res, req.WithContext(withLimitKey(req.Context(), key)))
+	})
+}
+
+// limitKey identifies the client of the request for the limits.
+func limitKey(req *http.Request, client *Client) string {
+	if client != nil {
+		return "client:" + client.ID
+	}
+
+	return "ip:" + remoteHost(req)
+}
+
+type limitKeyKey struct{}
+
+func withLimitKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, limitKeyKey{}, key)
+}
+
+func limitKeyFromContext(ctx context.Context) string {
+	if key, ok := ctx.Value(limitKeyKey{}).(string); ok {
+		return key
+	}
+
+	return ""
+}
+
+type slotKey struct{}
+
+// withSlot marks the context as holding a build slot.
+func withSlot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, slotKey{}, true)
+}
+
+func setRetryAfter(res http.ResponseWriter, delay time.Duration) {
+	res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+}
+
+var (
+	errRateLimited   = errors.New("rate limit exceeded")
+	errQuotaExceeded = errors.New("build quota exceeded")
+)
+
+// buildSlots limits the number of concurrent builds of the service, independently of the clients.
+// The builds over the limit wait for a free slot. A nil value means unlimited.
+type buildSlots chan struct{}
+
+func newBuildSlots(size int) buildSlots {
+	if size <= 0 {
+		return nil
+	}
+
+	return make(buildSlots, size)
+}
+
+// acquire waits for a free build slot, the returned function releases the slot.
+func (slots buildSlots) acquire(ctx context.Context) (func(), error) {
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
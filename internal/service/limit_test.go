@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	clients := []*Client{
+		{ID: "limited", Token: "limited"},
+		{ID: "unlimited", Token: "unlimited", RateLimit: 1000, RateBurst: 1000},
+	}
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{Clients: clients, RateLimit: 0.01, RateBurst: 1})
+	assert.NoError(t, err)
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/linux/amd64/k6@v0.46.0", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	assert.Equal(t, http.StatusOK, get("limited").Code)
+
+	res := get("limited")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.NotEmpty(t, res.Header().Get("Retry-After"))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, get("unlimited").Code)
+	}
+}
+
+func TestBuildQuota(t *testing.T) {
+	t.Parallel()
+
+	lim := newLimits(&Config{ClientBuilds: 1})
+	ctx := withLimitKey(context.Background(), "ip:192.0.2.1")
+
+	release, err := lim.acquire(ctx)
+	assert.NoError(t, err)
+
+	_, err = lim.acquire(ctx)
+	assert.ErrorIs(t, err, errQuotaExceeded)
+
+	// other client
+	other, err := lim.acquire(withLimitKey(context.Background(), "ip:192.0.2.2"))
+	assert.NoError(t, err)
+
+	other()
+
+	// the slot is held by the job
+	held, err := lim.acquire(withSlot(ctx))
+	assert.NoError(t, err)
+
+	held()
+	release()
+
+	release, err = lim.acquire(ctx)
+	assert.NoError(t, err)
+
+	release()
+
+	assert.Equal(t, http.StatusTooManyRequests, errorStatus(errQuotaExceeded))
+}
+
+func TestBuildSlots(t *testing.T) {
+	t.Parallel()
+
+	slots := newBuildSlots(1)
+
+	release, err := slots.acquire(context.Background())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = slots.acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	release()
+
+	release, err = slots.acquire(context.Background())
+	assert.NoError(t, err)
+
+	release()
+
+	// unlimited
+	_, err = newBuildSlots(0).acquire(ctx)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/szkiba/k6x/internal/builder"
+	"github.com/szkiba/k6x/internal/dependency"
+)
+
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+	metricsPath = "/metrics"
+
+	readyTimeout = 10 * time.Second
+
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// request outcomes
+const (
+	outcomeRedirect    = "redirect"
+	outcomeNotModified = "not_modified"
+	outcomeBuild       = "build"
+	outcomeJob         = "job"
+	outcomeError       = "error"
+)
+
+//nolint:gochecknoglobals
+var (
+	durationBuckets = []float64{10, 30, 60, 120, 300, 600, 1200}
+	sizeBuckets     = []float64{16 << 20, 32 << 20, 64 << 20, 128 << 20, 256 << 20}
+)
+
+// metrics collects the service metrics and writes them in the Prometheus text exposition format.
+type metrics struct {
+	mu sync.Mutex
+
+	requests  map[string]uint64
+	inflight  int64
+	hits      uint64
+	misses    uint64
+	durations *histogram
+	sizes     *histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:  make(map[string]uint64),
+		durations: newHistogram(durationBuckets),
+		sizes:     newHistogram(sizeBuckets),
+	}
+}
+
+func (m *metrics) request(outcome string) {
+	m.mu.Lock()
+	m.requests[outcome]++
+	m.mu.Unlock()
+}
+
+func (m *metrics) hit() {
+	m.mu.Lock()
+	m.hits++
+	m.mu.Unlock()
+}
+
+// buildStarted records a build start and returns the function to be called when the build is finished.
+func (m *metrics) buildStarted() func(size int, err error) {
+	started := time.Now()
+
+	m.mu.Lock()
+	m.inflight++
+	m.misses++
+	m.mu.Unlock()
+
+	return func(size int, err error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.inflight--
+
+		if err != nil {
+			return
+		}
+
+		m.durations.observe(time.Since(started).Seconds())
+		m.sizes.observe(float64(size))
+	}
+}
+
+func (m *metrics) write(out io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var buff strings.Builder
+
+	buff.WriteString("# HELP k6x_requests_total Number of build requests by outcome.\n")
+	buff.WriteString("# TYPE k6x_requests_total counter\n")
+
+	outcomes := make([]string, 0, len(m.requests))
+	for outcome := range m.requests {
+		outcomes = append(outcomes, outcome)
+	}
+
+	sort.Strings(outcomes)
+
+	for _, outcome := range outcomes {
+		fmt.Fprintf(&buff, "k6x_requests_total{outcome=%q} %d\n", outcome, m.requests[outcome])
+	}
+
+	buff.WriteString("# HELP k6x_builds_in_flight Number of builds in progress.\n")
+	buff.WriteString("# TYPE k6x_builds_in_flight gauge\n")
+	fmt.Fprintf(&buff, "k6x_builds_in_flight %d\n", m.inflight)
+
+	buff.WriteString("# HELP k6x_cache_hits_total Number of k6 binaries served without a new build.\n")
+	buff.WriteString("# TYPE k6x_cache_hits_total counter\n")
+	fmt.Fprintf(&buff, "k6x_cache_hits_total %d\n", m.hits)
+
+	buff.WriteString("# HELP k6x_cache_misses_total Number of k6 binaries built.\n")
+	buff.WriteString("# TYPE k6x_cache_misses_total counter\n")
+	fmt.Fprintf(&buff, "k6x_cache_misses_total %d\n", m.misses)
+
+	ratio := 0.0
+	if total := m.hits + m.misses; total != 0 {
+		ratio = float64(m.hits) / float64(total)
+	}
+
+	buff.WriteString("# HELP k6x_cache_hit_ratio Ratio of k6 binaries served without a new build.\n")
+	buff.WriteString("# TYPE k6x_cache_hit_ratio gauge\n")
+	fmt.Fprintf(&buff, "k6x_cache_hit_ratio %g\n", ratio)
+
+	m.durations.write(&buff, "k6x_build_duration_seconds", "Duration of the successful builds in seconds.")
+	m.sizes.write(&buff, "k6x_binary_size_bytes", "Size of the built k6 binaries in bytes.")
+
+	_, err := io.WriteString(out, buff.String())
+
+	return err
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += value
+}
+
+func (h *histogram) write(buff *strings.Builder, name, help string) {
+	fmt.Fprintf(buff, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buff, "# TYPE %s histogram\n", name)
+
+	for i, bound := range h.bounds {
+		fmt.Fprintf(buff, "%s_bucket{le=\"%g\"} %d\n", name, bound, h.counts[i])
+	}
+
+	fmt.Fprintf(buff, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(buff, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(buff, "%s_count %d\n", name, h.count)
+}
+
+func (svc *service) serveMetrics(res http.ResponseWriter, _ *http.Request) {
+	res.Header().Set("Content-Type", metricsContentType)
+	res.Header().Set("Cache-Control", "no-cache,no-store")
+
+	_ = svc.metrics.write(res)
+}
+
+func (svc *service) serveHealthz(res http.ResponseWriter, _ *http.Request) {
+	res.Header().Set("Cache-Control", "no-cache,no-store")
+
+	_, _ = io.WriteString(res, "ok\n")
+}
+
+// serveReadyz checks whether the builder engine and the resolver are usable.
+func (svc *service) serveReadyz(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Cache-Control", "no-cache,no-store")
+
+	ctx, cancel := context.WithTimeout(req.Context(), readyTimeout)
+	defer cancel()
+
+	if err := builder.Check(ctx, svc.builder); err != nil {
+		http.Error(res, fmt.Sprintf("builder %s: %s", svc.builder.Engine(), err.Error()), http.StatusServiceUnavailable)
+
+		return
+	}
+
+	deps := dependency.Dependencies{"k6": &dependency.Dependency{Name: "k6"}}
+
+	if _, err := svc.resolver.Resolve(ctx, deps); err != nil {
+		http.Error(res, "resolver: "+err.Error(), http.StatusServiceUnavailable)
+
+		return
+	}
+
+	_, _ = io.WriteString(res, "ok\n")
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{Clients: []*Client{{ID: "ci", Token: "secret"}}})
+	assert.NoError(t, err)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/linux/amd64/k6@v0.46.0").Code)
+	assert.Equal(t, http.StatusMovedPermanently, serve("/linux/amd64/k6@0.46.0").Code)
+	assert.Equal(t, http.StatusOK, serve("/healthz").Code)
+	assert.Equal(t, http.StatusOK, serve("/readyz").Code)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(), `k6x_requests_total{outcome="build"} 1`)
+	assert.Contains(t, res.Body.String(), `k6x_requests_total{outcome="redirect"} 1`)
+	assert.Contains(t, res.Body.String(), `k6x_builds_in_flight 0`)
+	assert.Contains(t, res.Body.String(), `k6x_binary_size_bytes_count 1`)
+}
@@ -11,6 +11,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/szkiba/k6x/internal/builder"
@@ -18,11 +19,15 @@ import (
 	"github.com/szkiba/k6x/internal/resolver"
 )
 
-var errInvalidParameters = errors.New("invalid parameters")
+var (
+	errInvalidParameters = errors.New("invalid parameters")
+	errInvalidOptions    = errors.New("invalid options")
+)
 
 type Params struct {
 	dependency.Artifacts
 	*builder.Platform
+	Options *builder.Options
 }
 
 func platformFromPath(str string) (*builder.Platform, string, error) {
@@ -40,12 +45,17 @@ func platformFromPath(str string) (*builder.Platform, string, error) {
 	return platform, parts[3], nil
 }
 
-func parseParams(str string) (*Params, error) {
-	platform, deplist, err := platformFromPath(str)
+func parseParams(loc *url.URL) (*Params, error) {
+	platform, deplist, err := platformFromPath(loc.Path)
 	if err != nil {
 		return nil, err
 	}
 
+	opts, err := builder.ParseOptions(loc.Query())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidOptions, err.Error())
+	}
+
 	arts, err := dependency.ParseArtifacts(deplist)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", errInvalidParameters, err.Error())
@@ -55,15 +65,20 @@ func parseParams(str string) (*Params, error) {
 		return nil, fmt.Errorf("%w: missing k6 parameter", errInvalidParameters)
 	}
 
-	return &Params{Artifacts: arts, Platform: platform}, nil
+	return &Params{Artifacts: arts, Platform: platform, Options: opts}, nil
 }
 
-func looseParseParams(ctx context.Context, str string, res resolver.Resolver) (*Params, error) {
-	platform, deplist, err := platformFromPath(str)
+func looseParseParams(ctx context.Context, loc *url.URL, res resolver.Resolver) (*Params, error) {
+	platform, deplist, err := platformFromPath(loc.Path)
 	if err != nil {
 		return nil, err
 	}
 
+	opts, err := builder.ParseOptions(loc.Query())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidOptions, err.Error())
+	}
+
 	deps, err := dependency.ParseLooseArtifacts(deplist)
 	if err != nil {
 		return nil, err
@@ -78,7 +93,7 @@ func looseParseParams(ctx context.Context, str string, res resolver.Resolver) (*
 		return nil, errInvalidParameters
 	}
 
-	return &Params{Artifacts: mods.ToArtifacts(), Platform: platform}, nil
+	return &Params{Artifacts: mods.ToArtifacts(), Platform: platform, Options: opts}, nil
 }
 
 func (pars *Params) String() string {
@@ -89,9 +104,22 @@ func (pars *Params) String() string {
 	buff.WriteRune('/')
 	buff.WriteString(pars.Artifacts.String())
 
+	if query := pars.Options.Encode(); len(query) != 0 {
+		buff.WriteRune('?')
+		buff.WriteString(query)
+	}
+
 	return buff.String()
 }
 
+func requestString(loc *url.URL) string {
+	if len(loc.RawQuery) == 0 {
+		return loc.Path
+	}
+
+	return loc.Path + "?" + loc.RawQuery
+}
+
 func (pars *Params) ETag() string {
 	sum := sha256.Sum256([]byte(pars.String()))
 	return base64.RawURLEncoding.EncodeToString(sum[:])
@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szkiba/k6x/internal/builder"
+	"github.com/szkiba/k6x/internal/dependency"
+)
+
+// revisionBuilder builds a different k6 binary after each change of its revision.
+type revisionBuilder struct {
+	revision atomic.Int32
+}
+
+func (*revisionBuilder) Engine() builder.Engine {
+	return builder.Native
+}
+
+func (b *revisionBuilder) Build(
+	_ context.Context,
+	platform *builder.Platform,
+	_ dependency.Modules,
+	out io.Writer,
+) (*builder.Manifest, error) {
+	_, err := fmt.Fprintf(out, "k6 for %s (%d)", platform.String(), b.revision.Load())
+
+	return &builder.Manifest{Engine: builder.Native, Platform: platform}, err
+}
+
+// expireJobs makes the finished jobs of the service handler expired.
+func expireJobs(handler http.Handler) {
+	js := handler.(*drainHandler).svc.jobs //nolint:forcetypeassert
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	finished := time.Now().Add(-2 * jobRetention * time.Second)
+
+	for _, j := range js.jobs {
+		j.mu.Lock()
+		j.Finished = &finished
+		j.mu.Unlock()
+	}
+}
+
+func TestProxy(t *testing.T) {
+	t.Parallel()
+
+	upstreamBuilder := new(revisionBuilder)
+
+	upstreamHandler, err := New(testResolver{}, upstreamBuilder, nil)
+	assert.NoError(t, err)
+
+	defer Drain(context.Background(), upstreamHandler) //nolint:errcheck
+
+	upstream := httptest.NewServer(upstreamHandler)
+	defer upstream.Close()
+
+	upstreamConfig := &builder.ServiceConfig{Endpoints: []string{upstream.URL}}
+
+	b, err := builder.NewServiceBuilder(context.Background(), upstreamConfig)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	params := mustParams(t, "/linux/amd64/k6@v0.46.0")
+	metaFile := filepath.Join(dir, params.ETag()+storeEntrySuffix)
+
+	// get starts a new proxy on the store (after modifying the stored entry)
+	get := func(b builder.Builder, body string, modify func(entry *storeEntry)) *httptest.ResponseRecorder {
+		if modify != nil {
+			src, err := os.ReadFile(metaFile)
+			assert.NoError(t, err)
+
+			entry := new(storeEntry)
+			assert.NoError(t, json.Unmarshal(src, entry))
+
+			modify(entry)
+
+			src, err = json.Marshal(entry)
+			assert.NoError(t, err)
+			assert.NoError(t, os.WriteFile(metaFile, src, 0o600))
+		}
+
+		handler, err := New(testResolver{}, b, &Config{StoreDir: dir})
+		assert.NoError(t, err)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, params.String(), nil))
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, body, res.Body.String())
+
+		return res
+	}
+
+	stale := func(entry *storeEntry) {
+		entry.Validated = time.Now().Add(-2 * defaultMaxAge)
+	}
+
+	assert.Empty(t, get(b, "k6 for linux/amd64 (0)", nil).Header().Get("X-Cache"))
+
+	// not modified upstream
+	assert.Equal(t, "HIT", get(b, "k6 for linux/amd64 (0)", stale).Header().Get("X-Cache"))
+
+	// modified upstream (after the upstream job of the previous revision has expired)
+	upstreamBuilder.revision.Store(1)
+	expireJobs(upstreamHandler)
+
+	assert.Equal(t, "HIT", get(b, "k6 for linux/amd64 (0)", nil).Header().Get("X-Cache"))
+	assert.Empty(t, get(b, "k6 for linux/amd64 (1)", stale).Header().Get("X-Cache"))
+
+	// the proxy starts and serves the stored artifacts without available upstream
+	upstream.Close()
+
+	b, err = builder.NewServiceBuilder(context.Background(), upstreamConfig)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "HIT", get(b, "k6 for linux/amd64 (1)", stale).Header().Get("X-Cache"))
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// parseRange parses a single byte range of the Range header for a content of the given size.
+// It returns false if the whole content should be served (e.g. multiple or malformed ranges).
+func parseRange(header string, size int64) (int64, int64, bool, error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.ContainsRune(spec, ',') {
+		return 0, 0, false, nil
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	if len(first) == 0 { // suffix range
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return 0, 0, false, nil //nolint:nilerr
+		}
+
+		if suffix <= 0 || size == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+
+		if suffix > size {
+			suffix = size
+		}
+
+		return size - suffix, size - 1, true, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, nil //nolint:nilerr
+	}
+
+	if start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+
+	end := size - 1
+
+	if len(last) != 0 {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false, nil //nolint:nilerr
+		}
+
+		if end >= size {
+			end = size - 1
+		}
+	}
+
+	return start, end, true, nil
+}
+
+// matchIfRange reports whether the range request should be served, according to the If-Range header.
+// Only the (strong) ETag form is supported, a date never matches.
+func matchIfRange(header string, etag string) bool {
+	if len(header) == 0 {
+		return true
+	}
+
+	return strings.Trim(header, `"`) == etag
+}
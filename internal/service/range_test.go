@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+	t.Parallel()
+
+	start, end, ok, err := parseRange("bytes=2-5", 10)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []int64{2, 5}, []int64{start, end})
+
+	start, end, ok, err = parseRange("bytes=4-", 10)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []int64{4, 9}, []int64{start, end})
+
+	start, end, ok, err = parseRange("bytes=-3", 10)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []int64{7, 9}, []int64{start, end})
+
+	_, _, ok, err = parseRange("bytes=0-1,4-5", 10)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, _, err = parseRange("bytes=10-", 10)
+	assert.ErrorIs(t, err, errRangeNotSatisfiable)
+}
+
+func TestServeRange(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{})
+	assert.NoError(t, err)
+
+	get := func(rng, ifRange string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/linux/amd64/k6@v0.46.0", nil)
+		req.Header.Set("Range", rng)
+
+		if len(ifRange) != 0 {
+			req.Header.Set("If-Range", ifRange)
+		}
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	res := get("bytes=3-", "")
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, "bytes 3-17/18", res.Header().Get("Content-Range"))
+	assert.Equal(t, "for linux/amd64", res.Body.String())
+
+	etag := res.Header().Get("ETag")
+
+	res = get("bytes=3-5", `"`+etag+`"`)
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, "for", res.Body.String())
+
+	res = get("bytes=3-5", "other")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "k6 for linux/amd64", res.Body.String())
+
+	res = get("bytes=100-", "")
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, res.Code)
+	assert.Equal(t, "bytes */18", res.Header().Get("Content-Range"))
+}
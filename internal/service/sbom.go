@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/szkiba/k6x/internal/sbom"
+)
+
+const sbomPrefix = "/sbom"
+
+func (svc *service) serveSBOM(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	params, err := parseParams(req.URL)
+	if err != nil {
+		if !errors.Is(err, errInvalidParameters) {
+			svc.error(res, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		params, err = looseParseParams(req.Context(), req.URL, svc.resolver)
+		if err != nil {
+			svc.error(res, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		res.Header().Set("Cache-Control", "no-cache,no-store")
+		svc.redirect(res, req, sbomPrefix+params.String(), http.StatusTemporaryRedirect)
+
+		return
+	}
+
+	log := logrus.WithField("params", params.String()).WithField("sbom", true)
+
+	if canonical := params.String(); requestString(req.URL) != canonical {
+		logAction(req.Context(), log.WithField("from", requestString(req.URL)), params, "redirect")
+
+		svc.setCacheControl(res)
+		svc.redirect(res, req, sbomPrefix+canonical, http.StatusMovedPermanently)
+
+		return
+	}
+
+	art, err := svc.build(req.Context(), params, log)
+	if err != nil {
+		svc.error(res, err.Error(), errorStatus(err))
+
+		return
+	}
+
+	binary, _, _, err := art.open("")
+	if err != nil {
+		svc.error(res, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	defer binary.Close() //nolint:errcheck
+
+	doc, err := sbom.Read(binary, art.manifest)
+	if err != nil {
+		log.WithError(err).Error("sbom error")
+
+		svc.error(res, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	svc.metrics.request(outcomeBuild)
+	auditFromContext(req.Context()).served(art)
+	svc.setCacheControl(res)
+	res.Header().Set("Content-Type", sbom.ContentType)
+
+	_ = doc.Write(res)
+}
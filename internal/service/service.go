@@ -9,11 +9,17 @@ package service
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/szkiba/k6x/internal/builder"
@@ -23,33 +29,185 @@ import (
 type service struct {
 	resolver resolver.Resolver
 	builder  builder.Builder
+	store    *store
+	flight   *flight
+	jobs     *jobs
+	auth     *auth
+	metrics  *metrics
+	catalogs *catalogs
+
+	signingKey ed25519.PrivateKey
+	version    string
+	disabled   bool
+	limits     *limits
+	auditor    *auditor
+
+	maxAge      time.Duration
+	maxAgeStale time.Duration
+	builds      buildSlots
+	running     *tracker
+	options     map[string]struct{}
 }
 
-func New(r resolver.Resolver, b builder.Builder) http.Handler {
+// Config contains the optional settings of the builder service.
+type Config struct {
+	// StoreDir is the directory of the artifact store, the store is disabled if empty.
+	StoreDir string
+	// StoreSize is the size limit of the artifact store in bytes, zero means unlimited.
+	StoreSize int64
+	// Clients lists the authorized clients, authentication is disabled if empty.
+	Clients []*Client
+	// SigningKey is the key used to sign the k6 binaries, the binaries are not signed if nil.
+	SigningKey ed25519.PrivateKey
+	// Version is the version of the service, reported by the info endpoint.
+	Version string
+	// Disabled tells the clients not to use the service (e.g. during maintenance).
+	Disabled bool
+	// RateLimit is the allowed request rate per client (requests per second), zero means unlimited.
+	RateLimit float64
+	// RateBurst is the allowed request burst per client, defaults to the rate limit.
+	RateBurst int
+	// ClientBuilds is the allowed number of concurrent builds per client, zero means unlimited.
+	ClientBuilds int
+	// AuditLog is the sink of the audit log (JSON lines), the audit log is disabled if nil.
+	AuditLog io.Writer
+	// MaxAge is the cache max-age of the k6 binaries and the revalidation period of the stored
+	// upstream artifacts, defaults to one hour.
+	MaxAge time.Duration
+	// MaxAgeStale is the cache stale-while-revalidate and stale-if-error period, defaults to ten minutes.
+	MaxAgeStale time.Duration
+	// MaxBuilds is the allowed number of concurrent builds of the service, zero means unlimited.
+	MaxBuilds int
+	// AllowedOptions lists the build options (cgo, race, tags, ldflags) the clients may use,
+	// only the build tags are allowed if nil.
+	AllowedOptions []string
+}
+
+// limited reports whether any request rate limit or build quota is configured.
+func (cfg *Config) limited() bool {
+	if cfg.RateLimit != 0 || cfg.ClientBuilds != 0 {
+		return true
+	}
+
+	for _, client := range cfg.Clients {
+		if client.RateLimit != 0 || client.MaxBuilds != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func New(r resolver.Resolver, b builder.Builder, cfg *Config) (http.Handler, error) {
 	svc := new(service)
 
 	svc.resolver = r
 	svc.builder = b
+	svc.flight = newFlight()
+	svc.jobs = newJobs()
+	svc.metrics = newMetrics()
+	svc.catalogs = newCatalogs()
+	svc.running = new(tracker)
+
+	if cfg == nil {
+		cfg = new(Config)
+	}
+
+	svc.signingKey = cfg.SigningKey
+	svc.version = cfg.Version
+	svc.disabled = cfg.Disabled
+	svc.builds = newBuildSlots(cfg.MaxBuilds)
+	svc.options = allowOptions(cfg.AllowedOptions)
+
+	svc.maxAge, svc.maxAgeStale = cfg.MaxAge, cfg.MaxAgeStale
+	if svc.maxAge == 0 {
+		svc.maxAge = defaultMaxAge
+	}
+
+	if svc.maxAgeStale == 0 {
+		svc.maxAgeStale = defaultMaxAgeStale
+	}
+
+	var err error
+
+	if len(cfg.StoreDir) != 0 {
+		if svc.store, err = newStore(cfg.StoreDir, cfg.StoreSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.Clients) != 0 {
+		if svc.auth, err = newAuth(cfg.Clients, r); err != nil {
+			return nil, err
+		}
+	}
 
-	return svc
+	if cfg.limited() {
+		svc.limits = newLimits(cfg)
+	}
+
+	if cfg.AuditLog != nil {
+		svc.auditor = newAuditor(cfg.AuditLog)
+	}
+
+	mux := http.NewServeMux()
+
+	mux.Handle(sbomPrefix+"/", http.StripPrefix(sbomPrefix, http.HandlerFunc(svc.serveSBOM)))
+	mux.HandleFunc(indexPath, svc.serveIndex)
+	mux.HandleFunc(buildPath, svc.serveBuild)
+	mux.HandleFunc(healthzPath, svc.serveHealthz)
+	mux.HandleFunc(readyzPath, svc.serveReadyz)
+	mux.HandleFunc(metricsPath, svc.serveMetrics)
+	mux.HandleFunc(catalogPath, svc.serveCatalog)
+	mux.HandleFunc(infoPath, svc.serveInfo)
+	mux.Handle(jobsPrefix+"/", http.StripPrefix(jobsPrefix, http.HandlerFunc(svc.serveJobs)))
+	mux.Handle("/", svc)
+
+	var handler http.Handler = mux
+
+	if svc.limits != nil {
+		handler = svc.limits.middleware(handler)
+	}
+
+	if svc.auth != nil {
+		handler = svc.auth.middleware(handler)
+	}
+
+	if svc.auditor != nil {
+		handler = svc.auditor.middleware(handler)
+	}
+
+	return &drainHandler{Handler: handler, svc: svc}, nil
 }
 
 func (svc *service) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	if req.Method != http.MethodGet {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
 		res.WriteHeader(http.StatusMethodNotAllowed)
 
 		return
 	}
 
-	params, err := parseParams(req.URL.Path)
+	if req.URL.Path == "/" {
+		svc.serveHome(res, req)
+
+		return
+	}
+
+	loc := *req.URL
+
+	var suffix string
+
+	loc.Path, suffix = sidecar(loc.Path)
+
+	params, err := parseParams(&loc)
 	if err != nil {
 		if errors.Is(err, errInvalidParameters) {
-			svc.looseServeHTTP(res, req)
+			svc.looseServeHTTP(res, req, &loc, suffix)
 
 			return
 		}
 
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		svc.error(res, err.Error(), http.StatusBadRequest)
 
 		return
 	}
@@ -58,100 +216,390 @@ func (svc *service) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 
 	canonical := params.String()
 
-	if req.URL.Path != canonical {
-		log.WithField("from", req.URL.Path).WithField("action", "redirect").Info()
+	if requestString(&loc) != canonical {
+		logAction(req.Context(), log.WithField("from", requestString(&loc)), params, "redirect")
 
-		setCacheControl(res)
-		http.Redirect(res, req, canonical, http.StatusMovedPermanently)
+		svc.setCacheControl(res)
+		svc.redirect(res, req, withSidecar(canonical, suffix), http.StatusMovedPermanently)
 
 		return
 	}
 
-	if req.Header.Get("If-None-Match") == params.ETag() {
-		log.WithField("action", "skip").Info()
+	if len(suffix) == 0 && params.matchETag(req.Header.Get("If-None-Match")) {
+		logAction(req.Context(), log, params, "skip")
 
+		svc.metrics.request(outcomeNotModified)
 		res.WriteHeader(http.StatusNotModified)
 
 		return
 	}
 
-	mods, err := svc.resolver.Resolve(req.Context(), params.ToDependencies())
+	art, err := svc.build(req.Context(), params, log)
 	if err != nil {
-		log.WithError(err).Error("resolve error")
+		svc.error(res, err.Error(), errorStatus(err))
+
+		return
+	}
+
+	svc.metrics.request(outcomeBuild)
+
+	if len(suffix) != 0 {
+		svc.writeSidecar(res, req, params, art, suffix)
+
+		return
+	}
+
+	svc.writeArtifact(res, req, params, art)
+}
+
+// writeArtifact writes the k6 binary, or its compressed variant accepted by the client, to the response.
+func (svc *service) writeArtifact(res http.ResponseWriter, req *http.Request, params *Params, art *artifact) {
+	body, size, encoding, err := art.open(negotiateEncoding(req.Header.Get("Accept-Encoding")))
+	if err != nil {
+		svc.error(res, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	defer body.Close() //nolint:errcheck
+
+	etag := params.ETag()
+
+	if len(encoding) != 0 {
+		etag += "-" + encoding
+
+		res.Header().Set("Content-Encoding", encoding)
+	}
+
+	res.Header().Add("Vary", "Accept-Encoding")
+	res.Header().Set("Accept-Ranges", "bytes")
+
+	status := http.StatusOK
+	length := size
+
+	if rng := req.Header.Get("Range"); len(rng) != 0 && matchIfRange(req.Header.Get("If-Range"), etag) {
+		start, end, partial, err := parseRange(rng, size)
+		if err != nil {
+			res.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(res, err.Error(), http.StatusRequestedRangeNotSatisfiable)
 
-		http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if partial {
+			if _, err := body.Seek(start, io.SeekStart); err != nil {
+				svc.error(res, err.Error(), http.StatusInternalServerError)
+
+				return
+			}
+
+			length = end - start + 1
+			status = http.StatusPartialContent
+
+			res.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		}
+	}
+
+	svc.setHeaders(res, params, int(length))
+	svc.setDigestHeaders(res, params, art)
+	auditFromContext(req.Context()).served(art)
+	res.Header().Set("ETag", etag)
+
+	if art.cached {
+		res.Header().Set("X-Cache", "HIT")
+	}
 
+	res.WriteHeader(status)
+
+	if req.Method == http.MethodHead {
 		return
 	}
 
+	_, _ = io.CopyN(res, body, length)
+}
+
+type artifact struct {
+	// data is the k6 binary of a fresh build
+	data []byte
+	// file is the k6 binary on the disk (e.g. in the artifact store), it is served instead of data if set
+	file     string
+	size     int64
+	digest   []byte
+	manifest *builder.Manifest
+	cached   bool
+	// validated is the time of the last (re)validation of a stored artifact
+	validated time.Time
+
+	// encoded contains the precomputed compressed variants by content encoding
+	encoded map[string][]byte
+	// variants contains the files of the compressed variants by content encoding (e.g. in the artifact store)
+	variants map[string]string
+}
+
+// content is the readable k6 binary or compressed variant.
+type content interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+}
+
+type memoryContent struct {
+	*bytes.Reader
+}
+
+func (memoryContent) Close() error {
+	return nil
+}
+
+// open opens the k6 binary, or its compressed variant with the given content encoding if it is available.
+// It returns the content, its size and its content encoding (empty for the k6 binary itself).
+func (art *artifact) open(encoding string) (content, int64, string, error) {
+	if len(encoding) != 0 {
+		if data, found := art.encoded[encoding]; found {
+			return memoryContent{bytes.NewReader(data)}, int64(len(data)), encoding, nil
+		}
+
+		if name, found := art.variants[encoding]; found {
+			if file, size, err := openContent(name); err == nil {
+				return file, size, encoding, nil
+			}
+		}
+	}
+
+	if len(art.file) == 0 {
+		return memoryContent{bytes.NewReader(art.data)}, int64(len(art.data)), "", nil
+	}
+
+	file, size, err := openContent(art.file)
+
+	return file, size, "", err
+}
+
+func openContent(name string) (content, int64, error) {
+	file, err := os.Open(name) //nolint:gosec
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+
+		return nil, 0, err
+	}
+
+	return file, info.Size(), nil
+}
+
+func (svc *service) build(ctx context.Context, params *Params, log *logrus.Entry) (*artifact, error) {
+	if err := svc.authorize(ctx, params); err != nil {
+		log.WithError(err).Warn("authorization error")
+
+		auditFromContext(ctx).act(params, "deny")
+
+		return nil, err
+	}
+
+	if svc.store != nil {
+		if art := svc.store.get(params); art != nil && svc.revalidate(ctx, params, art, log) {
+			logAction(ctx, log, params, "store")
+
+			svc.metrics.hit()
+
+			return art, nil
+		}
+	}
+
+	release, err := svc.limits.acquire(ctx)
+	if err != nil {
+		log.WithError(err).Warn("quota error")
+
+		return nil, err
+	}
+
+	defer release()
+
+	art, shared, err := svc.flight.do(ctx, params.String(), func(ctx context.Context) (*artifact, error) {
+		return svc.doBuild(ctx, params, log)
+	})
+
+	switch {
+	case shared && err == nil:
+		logAction(ctx, log, params, "wait")
+
+		svc.metrics.hit()
+	case shared:
+		auditFromContext(ctx).act(params, "wait")
+	default:
+		auditFromContext(ctx).act(params, "build")
+	}
+
+	return art, err
+}
+
+// revalidate checks whether the stored artifact is still valid, after it has been stored for max-age.
+// Only the artifacts built by an upstream build service can become invalid (proxy mode).
+// The invalid artifact is removed from the store. If the revalidation fails, the stored artifact is used.
+func (svc *service) revalidate(ctx context.Context, params *Params, art *artifact, log *logrus.Entry) bool {
+	if art.manifest == nil || time.Since(art.validated) < svc.maxAge {
+		return true
+	}
+
+	ctx = builder.WithOptions(ctx, params.Options)
+
+	valid, err := builder.Revalidate(ctx, svc.builder, params.Platform, art.manifest.Modules, hex.EncodeToString(art.digest))
+	if err != nil {
+		log.WithError(err).Warn("revalidate error")
+
+		return true
+	}
+
+	if !valid {
+		logAction(ctx, log, params, "invalidate")
+
+		svc.store.invalidate(params)
+
+		return false
+	}
+
+	if err := svc.store.validate(params); err != nil {
+		log.WithError(err).Warn("store error")
+	}
+
+	return true
+}
+
+func (svc *service) doBuild(ctx context.Context, params *Params, log *logrus.Entry) (*artifact, error) {
+	defer svc.running.start()()
+
+	mods, err := svc.resolver.Resolve(ctx, params.ToDependencies())
+	if err != nil {
+		log.WithError(err).Error("resolve error")
+
+		return nil, fmt.Errorf("%w: %s", errResolve, err.Error())
+	}
+
+	release, err := svc.builds.acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errBuild, err.Error())
+	}
+
+	defer release()
+
 	var buff bytes.Buffer
 
 	log.WithField("action", "build").Info()
 
-	if err := svc.builder.Build(req.Context(), params.Platform, mods, &buff); err != nil {
+	ctx = builder.WithOptions(ctx, params.Options)
+
+	done := svc.metrics.buildStarted()
+
+	man, err := svc.builder.Build(ctx, params.Platform, mods, &buff)
+
+	done(buff.Len(), err)
+	if err != nil {
 		log.WithError(err).Error("build error")
 
-		http.Error(res, err.Error(), http.StatusPreconditionFailed)
+		return nil, fmt.Errorf("%w: %s", errBuild, err.Error())
+	}
+
+	art := &artifact{data: buff.Bytes(), size: int64(buff.Len()), digest: checksum(buff.Bytes()), manifest: man}
 
-		return
+	if art.encoded, err = compress(art.data); err != nil {
+		log.WithError(err).Warn("compress error")
 	}
 
-	setHeaders(res, params, buff.Len())
+	if svc.store != nil {
+		if err := svc.store.put(params, art); err != nil {
+			log.WithError(err).Warn("store error")
+		}
+	}
+
+	return art, nil
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errResolve), errors.Is(err, errInvalidBuildRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, errUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, errForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, errQuotaExceeded):
+		return http.StatusTooManyRequests
+	}
 
-	_, _ = io.Copy(res, &buff)
+	return http.StatusPreconditionFailed
 }
 
-func (svc *service) looseServeHTTP(res http.ResponseWriter, req *http.Request) {
-	params, err := looseParseParams(req.Context(), req.URL.Path, svc.resolver)
+func (svc *service) looseServeHTTP(res http.ResponseWriter, req *http.Request, loc *url.URL, suffix string) {
+	params, err := looseParseParams(req.Context(), loc, svc.resolver)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		svc.error(res, err.Error(), http.StatusBadRequest)
 
 		return
 	}
 
 	canonical := params.String()
 
-	logrus.WithField("params", canonical).
-		WithField("from", req.URL.Path).
-		WithField("action", "resolve").
-		Info()
+	logAction(req.Context(), logrus.WithField("params", canonical).WithField("from", requestString(req.URL)), params, "resolve")
 
 	res.Header().Set("Cache-Control", "no-cache,no-store")
-	http.Redirect(res, req, canonical, http.StatusTemporaryRedirect)
+	svc.redirect(res, req, withSidecar(canonical, suffix), http.StatusTemporaryRedirect)
 }
 
-func setCacheControl(res http.ResponseWriter) {
+// error responds with an error and records the error outcome.
+func (svc *service) error(res http.ResponseWriter, msg string, status int) {
+	if status == http.StatusTooManyRequests {
+		setRetryAfter(res, quotaRetryAfter*time.Second)
+	}
+
+	svc.metrics.request(outcomeError)
+	http.Error(res, msg, status)
+}
+
+// redirect responds with a redirect and records the redirect outcome.
+func (svc *service) redirect(res http.ResponseWriter, req *http.Request, url string, status int) {
+	svc.metrics.request(outcomeRedirect)
+	http.Redirect(res, req, url, status)
+}
+
+func (svc *service) setCacheControl(res http.ResponseWriter) {
 	res.Header().
 		Set("Cache-Control",
 			fmt.Sprintf(
 				"public, max-age=%d, immutable, stale-while-revalidate=%d, stale-if-error=%d",
-				maxAge,
-				maxAgeStale,
-				maxAgeStale,
+				int(svc.maxAge.Seconds()),
+				int(svc.maxAgeStale.Seconds()),
+				int(svc.maxAgeStale.Seconds()),
 			),
 		)
 }
 
-func setHeaders(res http.ResponseWriter, params *Params, contentLength int) {
-	setCacheControl(res)
+func (svc *service) setHeaders(res http.ResponseWriter, params *Params, contentLength int) {
+	svc.setCacheControl(res)
 	res.Header().Set("Content-Length", strconv.Itoa(contentLength))
 	res.Header().Set("ETag", params.ETag())
 	res.Header().Set("Content-Type", "application/octet-stream")
 
-	ext := ""
+	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, binaryName(params)))
+}
+
+// binaryName returns the file name of the k6 binary for the platform of params.
+func binaryName(params *Params) string {
 	if params.OS == "windows" {
-		ext = ".exe"
+		return "k6.exe"
 	}
 
-	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="k6%s"`, ext))
+	return "k6"
 }
 
-const (
-	maxAge      = 60 * 60 // ~ 1 hour
-	maxAgeStale = 60 * 10 // ~ 10 mins
-	maxAgeError = 60 * 5  // ~ 5 mins
+var (
+	errResolve = errors.New("resolve error")
+	errBuild   = errors.New("build error")
+)
 
-	// maxAge   = 60 * 60 * 24 * 30 * 3 // ~ 3 month
-	// maxAgeStale = 60 * 60 * 24 * 7      // ~ 1 weeks
-	// maxAgeError = 60 * 5  // ~ 5 mins
+const (
+	defaultMaxAge      = time.Hour
+	defaultMaxAgeStale = 10 * time.Minute
 )
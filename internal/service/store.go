@@ -0,0 +1,471 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/szkiba/k6x/internal/builder"
+)
+
+const (
+	indexPath = "/index"
+
+	storeEntrySuffix = ".json"
+)
+
+// store is a content-addressed artifact store in a local directory.
+// Artifacts are keyed by the ETag of the request parameters,
+// the least recently used artifacts are evicted when the size limit is exceeded.
+type store struct {
+	dir   string
+	limit int64
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*storeEntry
+}
+
+type storeEntry struct {
+	ETag      string            `json:"etag"`
+	Params    string            `json:"params"`
+	Size      int64             `json:"size"`
+	Checksum  string            `json:"checksum,omitempty"`
+	Encoded   map[string]int64  `json:"encoded,omitempty"`
+	Created   time.Time         `json:"created"`
+	Accessed  time.Time         `json:"accessed"`
+	Validated time.Time         `json:"validated"`
+	Manifest  *builder.Manifest `json:"manifest,omitempty"`
+}
+
+// verify reports whether digest matches the checksum of the entry (entries without checksum are not verified).
+func (entry *storeEntry) verify(digest []byte) bool {
+	return len(entry.Checksum) == 0 || entry.Checksum == hex.EncodeToString(digest)
+}
+
+// total returns the size of the binary and its compressed variants.
+func (entry *storeEntry) total() int64 {
+	total := entry.Size
+
+	for _, size := range entry.Encoded {
+		total += size
+	}
+
+	return total
+}
+
+type storeIndex struct {
+	Size    int64         `json:"size"`
+	Limit   int64         `json:"limit"`
+	Entries []*storeEntry `json:"entries"`
+}
+
+func newStore(dir string, limit int64) (*store, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	st := &store{dir: dir, limit: limit, entries: make(map[string]*storeEntry)}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+
+		if strings.HasSuffix(name, ".tmp") {
+			_ = os.Remove(filepath.Join(dir, name))
+
+			continue
+		}
+
+		if file.IsDir() || !strings.HasSuffix(name, storeEntrySuffix) {
+			continue
+		}
+
+		entry, err := st.load(strings.TrimSuffix(name, storeEntrySuffix))
+		if err != nil {
+			logrus.WithError(err).WithField("entry", name).Warn("invalid store entry")
+
+			st.remove(strings.TrimSuffix(name, storeEntrySuffix))
+
+			continue
+		}
+
+		st.entries[entry.ETag] = entry
+		st.size += entry.total()
+	}
+
+	st.mu.Lock()
+	st.evict()
+	st.mu.Unlock()
+
+	return st, nil
+}
+
+func (st *store) file(etag string) string {
+	return filepath.Join(st.dir, etag)
+}
+
+func (st *store) variantFile(etag, encoding string) string {
+	return st.file(etag) + encodingSuffixes[encoding]
+}
+
+func (st *store) load(etag string) (*storeEntry, error) {
+	src, err := os.ReadFile(st.file(etag) + storeEntrySuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := new(storeEntry)
+
+	if err = json.Unmarshal(src, entry); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(st.file(etag))
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.ETag != etag || info.Size() != entry.Size {
+		return nil, errInvalidStoreEntry
+	}
+
+	entry.Accessed = info.ModTime()
+
+	for encoding, size := range entry.Encoded {
+		if info, err := os.Stat(st.variantFile(etag, encoding)); err != nil || info.Size() != size {
+			delete(entry.Encoded, encoding)
+		}
+	}
+
+	return entry, nil
+}
+
+// get returns the stored artifact for params, or nil if it is not in the store.
+// The k6 binary is verified, but it is not loaded into memory, it is served from the store.
+func (st *store) get(params *Params) *artifact {
+	etag := params.ETag()
+
+	st.mu.Lock()
+	entry, found := st.entries[etag]
+	st.mu.Unlock()
+
+	if !found {
+		return nil
+	}
+
+	digest, size, err := fileChecksum(st.file(etag))
+
+	if err == nil && (size != entry.Size || !entry.verify(digest)) {
+		err = errInvalidStoreEntry
+	}
+
+	if err != nil {
+		logrus.WithError(err).WithField("params", entry.Params).Warn("invalid store entry")
+
+		st.mu.Lock()
+		st.drop(etag)
+		st.mu.Unlock()
+
+		return nil
+	}
+
+	now := time.Now()
+
+	_ = os.Chtimes(st.file(etag), now, now)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	entry.Accessed = now
+
+	variants := make(map[string]string, len(entry.Encoded))
+	for encoding := range entry.Encoded {
+		variants[encoding] = st.variantFile(etag, encoding)
+	}
+
+	return &artifact{
+		file:      st.file(etag),
+		size:      size,
+		digest:    digest,
+		manifest:  entry.Manifest,
+		cached:    true,
+		validated: entry.Validated,
+		variants:  variants,
+	}
+}
+
+// fileChecksum returns the SHA-256 digest and the size of the file.
+func fileChecksum(name string) ([]byte, int64, error) {
+	file, err := os.Open(name) //nolint:gosec
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer file.Close() //nolint:errcheck
+
+	hash := sha256.New()
+
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return hash.Sum(nil), size, nil
+}
+
+// put stores the artifact and evicts the least recently used artifacts if the size limit is exceeded.
+func (st *store) put(params *Params, art *artifact) error {
+	size := int64(len(art.data))
+	encoded := make(map[string]int64, len(art.encoded))
+
+	for encoding, data := range art.encoded {
+		encoded[encoding] = int64(len(data))
+	}
+
+	now := time.Now()
+	entry := &storeEntry{
+		ETag:      params.ETag(),
+		Params:    params.String(),
+		Size:      size,
+		Checksum:  hex.EncodeToString(art.digest),
+		Encoded:   encoded,
+		Created:   now,
+		Accessed:  now,
+		Validated: now,
+		Manifest:  art.manifest,
+	}
+
+	if st.limit > 0 && entry.total() > st.limit {
+		return nil
+	}
+
+	meta, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = writeFileAtomic(st.file(entry.ETag), art.data); err != nil {
+		return err
+	}
+
+	for encoding, data := range art.encoded {
+		if err = writeFileAtomic(st.variantFile(entry.ETag, encoding), data); err != nil {
+			st.remove(entry.ETag)
+
+			return err
+		}
+	}
+
+	if err = writeFileAtomic(st.file(entry.ETag)+storeEntrySuffix, meta); err != nil {
+		st.remove(entry.ETag)
+
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if prev, found := st.entries[entry.ETag]; found {
+		st.size -= prev.total()
+	}
+
+	st.entries[entry.ETag] = entry
+	st.size += entry.total()
+
+	st.evict()
+
+	return nil
+}
+
+// evict removes the least recently used entries until the store fits in the limit. Must be called with mu held.
+func (st *store) evict() {
+	if st.limit <= 0 || st.size <= st.limit {
+		return
+	}
+
+	entries := make([]*storeEntry, 0, len(st.entries))
+	for _, entry := range st.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Accessed.Before(entries[j].Accessed)
+	})
+
+	for _, entry := range entries {
+		if st.size <= st.limit {
+			break
+		}
+
+		logrus.WithField("params", entry.Params).WithField("action", "evict").Info()
+
+		st.drop(entry.ETag)
+	}
+}
+
+// validate records the successful revalidation of the stored artifact.
+func (st *store) validate(params *Params) error {
+	st.mu.Lock()
+
+	entry, found := st.entries[params.ETag()]
+	if !found {
+		st.mu.Unlock()
+
+		return nil
+	}
+
+	entry.Validated = time.Now()
+
+	meta, err := json.MarshalIndent(entry, "", "  ")
+
+	st.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(st.file(params.ETag())+storeEntrySuffix, meta)
+}
+
+// invalidate removes the stored artifact of params.
+func (st *store) invalidate(params *Params) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.drop(params.ETag())
+}
+
+// drop removes the entry from the index and from the disk. Must be called with mu held.
+func (st *store) drop(etag string) {
+	if entry, found := st.entries[etag]; found {
+		st.size -= entry.total()
+		delete(st.entries, etag)
+	}
+
+	st.remove(etag)
+}
+
+func (st *store) remove(etag string) {
+	_ = os.Remove(st.file(etag) + storeEntrySuffix)
+	_ = os.Remove(st.file(etag))
+
+	for _, encoding := range encodings {
+		_ = os.Remove(st.variantFile(etag, encoding))
+	}
+}
+
+func (st *store) index() *storeIndex {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	idx := &storeIndex{Size: st.size, Limit: st.limit, Entries: make([]*storeEntry, 0, len(st.entries))}
+
+	// the entries are copied, because they are updated (e.g. on access) after the lock is released
+	for _, entry := range st.entries {
+		entry := *entry
+
+		idx.Entries = append(idx.Entries, &entry)
+	}
+
+	sort.Slice(idx.Entries, func(i, j int) bool {
+		return idx.Entries[i].Accessed.After(idx.Entries[j].Accessed)
+	})
+
+	return idx
+}
+
+func (svc *service) serveIndex(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if svc.store == nil {
+		http.Error(res, errNoStore.Error(), http.StatusNotFound)
+
+		return
+	}
+
+	idx := svc.store.index()
+	idx.Entries = svc.visibleEntries(req.Context(), idx.Entries)
+
+	res.Header().Set("Cache-Control", "no-cache,no-store")
+	res.Header().Set("Content-Type", "application/json")
+
+	encoder := json.NewEncoder(res)
+	encoder.SetIndent("", "  ")
+
+	_ = encoder.Encode(idx)
+}
+
+// visibleEntries returns the entries the client of the context is allowed to build,
+// so the index doesn't reveal the build parameters of the other clients.
+func (svc *service) visibleEntries(ctx context.Context, entries []*storeEntry) []*storeEntry {
+	visible := make([]*storeEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		loc, err := url.Parse(entry.Params)
+		if err != nil {
+			continue
+		}
+
+		params, err := parseParams(loc)
+		if err != nil || svc.authorize(ctx, params) != nil {
+			continue
+		}
+
+		visible = append(visible, entry)
+	}
+
+	return visible
+}
+
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+var (
+	errNoStore           = errors.New("artifact store is not enabled")
+	errInvalidStoreEntry = errors.New("invalid store entry")
+)
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2023 Iván SZKIBA
+//
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	st, err := newStore(dir, 10)
+	assert.NoError(t, err)
+
+	first := mustParams(t, "/linux/amd64/k6@v0.46.0")
+	second := mustParams(t, "/linux/amd64/k6@v0.45.0")
+
+	assert.Nil(t, st.get(first))
+
+	assert.NoError(t, st.put(first, &artifact{data: []byte("012345")}))
+
+	art := st.get(first)
+	assert.NotNil(t, art)
+	assert.True(t, art.cached)
+	assert.Nil(t, art.data)
+
+	body, size, _, err := art.open("")
+	assert.NoError(t, err)
+
+	data, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.NoError(t, body.Close())
+	assert.Equal(t, int64(6), size)
+	assert.Equal(t, []byte("012345"), data)
+
+	assert.NoError(t, st.put(second, &artifact{data: []byte("6789ab")}))
+
+	assert.Nil(t, st.get(first))
+	assert.NotNil(t, st.get(second))
+	assert.Equal(t, int64(6), st.index().Size)
+
+	st, err = newStore(dir, 10)
+	assert.NoError(t, err)
+
+	assert.Len(t, st.index().Entries, 1)
+	assert.NotNil(t, st.get(second))
+}
+
+func TestStoreConcurrentIndex(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{StoreDir: t.TempDir()})
+	assert.NoError(t, err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return res
+	}
+
+	assert.Equal(t, http.StatusOK, get("/linux/amd64/k6@v0.46.0").Code)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			assert.Equal(t, "HIT", get("/linux/amd64/k6@v0.46.0").Header().Get("X-Cache"))
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			assert.Equal(t, http.StatusOK, get(indexPath).Code)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func mustParams(t *testing.T, path string) *Params {
+	t.Helper()
+
+	params, err := parseParams(&url.URL{Path: path})
+	assert.NoError(t, err)
+
+	return params
+}
+
+func TestIndexRestricted(t *testing.T) {
+	t.Parallel()
+
+	clients := []*Client{
+		{ID: "all", Token: "all"},
+		{ID: "arm", Token: "arm", Platforms: []string{"linux/arm64"}},
+	}
+
+	handler, err := New(testResolver{}, testBuilder{}, &Config{StoreDir: t.TempDir(), Clients: clients})
+	assert.NoError(t, err)
+
+	get := func(token, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	assert.Equal(t, http.StatusOK, get("all", "/linux/amd64/k6@v0.46.0").Code)
+	assert.Equal(t, http.StatusOK, get("arm", "/linux/arm64/k6@v0.46.0").Code)
+
+	entries := func(token string) []string {
+		var idx storeIndex
+
+		assert.NoError(t, json.Unmarshal(get(token, indexPath).Body.Bytes(), &idx))
+
+		params := make([]string, 0, len(idx.Entries))
+		for _, entry := range idx.Entries {
+			params = append(params, entry.Params)
+		}
+
+		return params
+	}
+
+	assert.ElementsMatch(t, []string{"/linux/amd64/k6@v0.46.0", "/linux/arm64/k6@v0.46.0"}, entries("all"))
+	assert.Equal(t, []string{"/linux/arm64/k6@v0.46.0"}, entries("arm"))
+}